@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gotasks/middleware"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type task struct {
+	Title     string            `json:"title"`
+	Completed bool              `json:"completed"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after interface{}
+		want          []Change
+	}{
+		{
+			name:  "created",
+			after: task{Title: "Write report"},
+			want: []Change{
+				{Field: "completed", Before: nil, After: false},
+				{Field: "title", Before: nil, After: "Write report"},
+			},
+		},
+		{
+			name:   "deleted",
+			before: task{Title: "Write report", Completed: true},
+			want: []Change{
+				{Field: "completed", Before: true, After: nil},
+				{Field: "title", Before: "Write report", After: nil},
+			},
+		},
+		{
+			name:   "updated field only",
+			before: task{Title: "Write report"},
+			after:  task{Title: "Write report", Completed: true},
+			want:   []Change{{Field: "completed", Before: false, After: true}},
+		},
+		{
+			name:   "nested fields",
+			before: task{Title: "a", Labels: map[string]string{"colour": "red", "size": "s"}},
+			after:  task{Title: "a", Labels: map[string]string{"colour": "blue", "size": "s"}},
+			want:   []Change{{Field: "labels.colour", Before: "red", After: "blue"}},
+		},
+		{
+			name:   "unchanged",
+			before: task{Title: "a"},
+			after:  &task{Title: "a"},
+			want:   nil,
+		},
+		{
+			name:   "typed nil counts as no state",
+			before: (*task)(nil),
+			after:  task{Title: "a"},
+			want: []Change{
+				{Field: "completed", Before: nil, After: false},
+				{Field: "title", Before: nil, After: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTasksReassignedEvent(t *testing.T) {
+	e := TasksReassignedEvent("u1", "u2", 3)
+	want := Event{Action: TasksReassigned, TargetType: TargetUser, TargetID: "u1", Count: 3,
+		Changes: []Change{{Field: "ownerId", Before: "u1", After: "u2"}}}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("TasksReassignedEvent() = %+v, want %+v", e, want)
+	}
+
+	// Ownerless tasks are recorded against their new owner
+	e = TasksReassignedEvent("", "u2", 5)
+	want = Event{Action: TasksReassigned, TargetType: TargetUser, TargetID: "u2", Count: 5,
+		Changes: []Change{{Field: "ownerId", Before: nil, After: "u2"}}}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("TasksReassignedEvent() = %+v, want %+v", e, want)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	got := Filter{Action: TaskUpdated, ActorID: "abc", TargetType: TargetTask, From: from, To: to}.query()
+	want := bson.M{
+		"action":       TaskUpdated,
+		"actor.userId": "abc",
+		"targetType":   TargetTask,
+		"time":         bson.M{"$gte": from, "$lt": to},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query() = %v, want %v", got, want)
+	}
+
+	if got := (Filter{}).query(); len(got) != 0 {
+		t.Errorf("empty filter query() = %v, want no conditions", got)
+	}
+}
+
+type fakeRecorder struct {
+	events []Event
+}
+
+func (r *fakeRecorder) Record(_ context.Context, e Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestRecordRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newContext := func() *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("POST", "/tasks", nil)
+		c.Request.RemoteAddr = "203.0.113.7:4242"
+		c.Request.Header.Set("User-Agent", "curl/8.0")
+		return c
+	}
+
+	rec := &fakeRecorder{}
+
+	c := newContext()
+	c.Set(middleware.ClaimsKey, &utils.Claims{UserID: "u1", Username: "alice"})
+	RecordRequest(c, rec, Event{Action: TaskCreated})
+
+	// Unauthenticated events keep the actor they name
+	RecordRequest(newContext(), rec, Event{Action: LoginFailed, Actor: Actor{Username: "mallory"}})
+
+	want := []Actor{
+		{UserID: "u1", Username: "alice", IP: "203.0.113.7", UserAgent: "curl/8.0"},
+		{Username: "mallory", IP: "203.0.113.7", UserAgent: "curl/8.0"},
+	}
+	if len(rec.events) != len(want) {
+		t.Fatalf("recorded %d events, want %d", len(rec.events), len(want))
+	}
+	for i, e := range rec.events {
+		if e.Actor != want[i] {
+			t.Errorf("event %d actor = %+v, want %+v", i, e.Actor, want[i])
+		}
+	}
+
+	// A nil recorder is allowed and records nothing
+	RecordRequest(newContext(), nil, Event{Action: TaskCreated})
+}
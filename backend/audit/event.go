@@ -0,0 +1,149 @@
+// Package audit keeps an append-only record of security-relevant and
+// data-changing events: who did what, from where, and what changed.
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Action names the kind of event.
+type Action string
+
+const (
+	LoginSucceeded      Action = "auth.login"
+	LoginFailed         Action = "auth.login_failed"
+	Registered          Action = "auth.register"
+	RoleChanged         Action = "user.role_changed"
+	UserDisabled        Action = "user.disabled"
+	UserEnabled         Action = "user.enabled"
+	PasswordResetForced Action = "user.password_reset_forced"
+	UserDeleted         Action = "user.deleted"
+	TaskCreated         Action = "task.created"
+	TaskUpdated         Action = "task.updated"
+	TaskDeleted         Action = "task.deleted"
+	// Bulk task changes, such as those of an account deletion, are one event
+	// each, targeting the user whose tasks they were.
+	TasksDeleted    Action = "task.bulk_deleted"
+	TasksReassigned Action = "task.bulk_reassigned"
+)
+
+// Target types.
+const (
+	TargetUser = "user"
+	TargetTask = "task"
+)
+
+// Actor is who caused an event and where the request came from. For failed
+// logins UserID is empty and Username is the name that was tried.
+type Actor struct {
+	UserID    string `bson:"userId,omitempty" json:"userId,omitempty"`
+	Username  string `bson:"username,omitempty" json:"username,omitempty"`
+	IP        string `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+}
+
+// Change is one field whose value differs between the before and after
+// states of the target. Before is nil for created fields, After for removed ones.
+type Change struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
+
+// Event is one audit log entry.
+type Event struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Time       time.Time          `bson:"time" json:"time"`
+	Action     Action             `bson:"action" json:"action"`
+	Actor      Actor              `bson:"actor" json:"actor"`
+	TargetType string             `bson:"targetType,omitempty" json:"targetType,omitempty"`
+	TargetID   string             `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	// Reason says why a failed action failed, e.g. "invalid_credentials".
+	Reason  string   `bson:"reason,omitempty" json:"reason,omitempty"`
+	Changes []Change `bson:"changes,omitempty" json:"changes,omitempty"`
+	// Count is how many targets a bulk action affected.
+	Count int64 `bson:"count,omitempty" json:"count,omitempty"`
+}
+
+// TasksDeletedEvent describes deleting all count tasks of the user ownerID.
+func TasksDeletedEvent(ownerID string, count int64) Event {
+	return Event{Action: TasksDeleted, TargetType: TargetUser, TargetID: ownerID, Count: count}
+}
+
+// TasksReassignedEvent describes handing count tasks from the user fromID to
+// the user toID. An empty fromID means the tasks had no owner; the event then
+// targets the new owner.
+func TasksReassignedEvent(fromID, toID string, count int64) Event {
+	e := Event{Action: TasksReassigned, TargetType: TargetUser, TargetID: fromID, Count: count}
+	change := Change{Field: "ownerId", Before: fromID, After: toID}
+	if fromID == "" {
+		e.TargetID = toID
+		change.Before = nil
+	}
+	e.Changes = []Change{change}
+	return e
+}
+
+// Diff compares two states of a target by their JSON form and returns the
+// fields that differ, sorted by name. Nested objects are compared field by
+// field with dotted names; arrays are compared whole. A nil state has no
+// fields, so Diff(nil, x) lists everything in x as created.
+func Diff(before, after interface{}) []Change {
+	from, to := fields(before), fields(after)
+
+	names := make([]string, 0, len(from)+len(to))
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	for _, name := range names {
+		if !reflect.DeepEqual(from[name], to[name]) {
+			changes = append(changes, Change{Field: name, Before: from[name], After: to[name]})
+		}
+	}
+	return changes
+}
+
+// fields flattens the JSON form of v into dotted field names.
+func fields(v interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	if v == nil {
+		return out
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return out
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return out
+	}
+	flatten("", doc, out)
+	return out
+}
+
+func flatten(prefix string, doc map[string]interface{}, out map[string]interface{}) {
+	for key, value := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flatten(name, nested, out)
+			continue
+		}
+		out[name] = value
+	}
+}
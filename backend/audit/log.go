@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Recorder stores audit events. *Log is the real one.
+type Recorder interface {
+	Record(ctx context.Context, e Event) error
+}
+
+// Log keeps events in their own collection. It only ever inserts; nothing in
+// the application updates or deletes an entry.
+type Log struct {
+	col *mongo.Collection
+}
+
+func NewLog(col *mongo.Collection) *Log {
+	return &Log{col: col}
+}
+
+// EnsureIndexes creates the indexes behind the admin query filters, all
+// ordered newest first.
+func (l *Log) EnsureIndexes(ctx context.Context) error {
+	_, err := l.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor.userId", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+// Record appends e, stamping it with the current time if it has none.
+func (l *Log) Record(ctx context.Context, e Event) error {
+	e.ID = primitive.NewObjectID()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	_, err := l.col.InsertOne(ctx, e)
+	return err
+}
+
+// Filter narrows a query. Zero fields match everything; From is inclusive
+// and To exclusive.
+type Filter struct {
+	Action     Action
+	ActorID    string
+	Username   string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+// query turns f into a MongoDB filter.
+func (f Filter) query() bson.M {
+	q := bson.M{}
+	if f.Action != "" {
+		q["action"] = f.Action
+	}
+	if f.ActorID != "" {
+		q["actor.userId"] = f.ActorID
+	}
+	if f.Username != "" {
+		q["actor.username"] = f.Username
+	}
+	if f.TargetType != "" {
+		q["targetType"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		q["targetId"] = f.TargetID
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		window := bson.M{}
+		if !f.From.IsZero() {
+			window["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			window["$lt"] = f.To
+		}
+		q["time"] = window
+	}
+	return q
+}
+
+// newestFirst orders events by time, breaking ties by insertion order.
+var newestFirst = bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}
+
+// Query returns the events matching f, newest first, skipping skip and
+// returning at most limit, together with the total number of matches.
+func (l *Log) Query(ctx context.Context, f Filter, skip, limit int64) ([]Event, int64, error) {
+	q := f.query()
+	total, err := l.col.CountDocuments(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := l.col.Find(ctx, q, options.Find().SetSort(newestFirst).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	events := []Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Export writes every event matching f to w as JSON Lines, one event per
+// line, newest first. Events are streamed, so large exports are not held in
+// memory.
+func (l *Log) Export(ctx context.Context, f Filter, w io.Writer) error {
+	cursor, err := l.col.Find(ctx, f.query(), options.Find().SetSort(newestFirst))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	enc := json.NewEncoder(w)
+	for cursor.Next(ctx) {
+		var e Event
+		if err := cursor.Decode(&e); err != nil {
+			return err
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
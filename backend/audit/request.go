@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gotasks/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordRequest records e as caused by the request c: the actor is the
+// authenticated caller, if any, plus the client IP and user agent. Fields
+// already set on e.Actor are kept, so unauthenticated events such as logins
+// can name the user themselves. A nil rec records nothing.
+//
+// Failures are logged rather than returned; by the time an event is
+// recorded the action it describes has already happened.
+func RecordRequest(c *gin.Context, rec Recorder, e Event) {
+	if rec == nil {
+		return
+	}
+
+	if claims, ok := middleware.CurrentUser(c); ok {
+		if e.Actor.UserID == "" {
+			e.Actor.UserID = claims.UserID
+		}
+		if e.Actor.Username == "" {
+			e.Actor.Username = claims.Username
+		}
+	}
+	e.Actor.IP = c.ClientIP()
+	e.Actor.UserAgent = c.Request.UserAgent()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rec.Record(ctx, e); err != nil {
+		log.Printf("audit: recording %s: %v", e.Action, err)
+	}
+}
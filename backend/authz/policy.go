@@ -0,0 +1,75 @@
+package authz
+
+import "gotasks/models"
+
+// Action names something a caller may want to do to a resource.
+type Action string
+
+const (
+	TaskRead   Action = "tasks:read"
+	TaskWrite  Action = "tasks:write"
+	UserRead   Action = "users:read"
+	UserManage Action = "users:manage"
+	AuditRead  Action = "audit:read"
+)
+
+// TokenScopes are the actions a personal access token can be granted.
+var TokenScopes = []Action{TaskRead, TaskWrite}
+
+// IsTokenScope reports whether action can be granted to a personal access token.
+func IsTokenScope(action Action) bool {
+	for _, a := range TokenScopes {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope describes how far a role's permission for an action reaches.
+type Scope int
+
+const (
+	// ScopeNone means the action is not allowed at all.
+	ScopeNone Scope = iota
+	// ScopeOwn allows the action only on resources the caller owns.
+	ScopeOwn
+	// ScopeAny allows the action on every resource, whoever owns it.
+	ScopeAny
+)
+
+// policies is the single place where roles are mapped to what they may do.
+// Handlers and middleware ask ScopeFor/Allowed instead of comparing roles themselves.
+var policies = map[string]map[Action]Scope{
+	models.RoleAdmin: {
+		TaskRead:   ScopeAny,
+		TaskWrite:  ScopeAny,
+		UserRead:   ScopeAny,
+		UserManage: ScopeAny,
+		AuditRead:  ScopeAny,
+	},
+	models.RoleUser: {
+		TaskRead:  ScopeOwn,
+		TaskWrite: ScopeOwn,
+		UserRead:  ScopeOwn,
+	},
+}
+
+// ScopeFor returns how far role may perform action. Unknown roles and
+// actions get ScopeNone.
+func ScopeFor(role string, action Action) Scope {
+	return policies[role][action]
+}
+
+// Allowed reports whether role may perform action on a resource; isOwner
+// tells whether the caller owns that resource.
+func Allowed(role string, action Action, isOwner bool) bool {
+	switch ScopeFor(role, action) {
+	case ScopeAny:
+		return true
+	case ScopeOwn:
+		return isOwner
+	default:
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package authz
+
+import (
+	"testing"
+
+	"gotasks/models"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		action  Action
+		isOwner bool
+		want    bool
+	}{
+		{name: "User reads own task", role: models.RoleUser, action: TaskRead, isOwner: true, want: true},
+		{name: "User reads other's task", role: models.RoleUser, action: TaskRead, isOwner: false, want: false},
+		{name: "User writes other's task", role: models.RoleUser, action: TaskWrite, isOwner: false, want: false},
+		{name: "User manages users", role: models.RoleUser, action: UserManage, isOwner: true, want: false},
+		{name: "Admin writes other's task", role: models.RoleAdmin, action: TaskWrite, isOwner: false, want: true},
+		{name: "Admin manages users", role: models.RoleAdmin, action: UserManage, isOwner: false, want: true},
+		{name: "User reads audit log", role: models.RoleUser, action: AuditRead, isOwner: true, want: false},
+		{name: "Admin reads audit log", role: models.RoleAdmin, action: AuditRead, isOwner: false, want: true},
+		{name: "Unknown role", role: "manager", action: TaskRead, isOwner: true, want: false},
+		{name: "Unknown action", role: models.RoleAdmin, action: "reports:read", isOwner: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.role, tt.action, tt.isOwner); got != tt.want {
+				t.Errorf("Allowed(%q, %q, %v) = %v, want %v", tt.role, tt.action, tt.isOwner, got, tt.want)
+			}
+		})
+	}
+}
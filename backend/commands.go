@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gotasks/audit"
+	"gotasks/config"
+	"gotasks/controllers"
+	"gotasks/handlers"
+	"gotasks/migrations"
+	"gotasks/models"
+	"gotasks/passhash"
+	"gotasks/passpolicy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// runCommand executes a one-off maintenance subcommand instead of starting the server.
+//
+//	gotasks assign-orphans -owner <username>
+//	gotasks create-admin -username <username> [-password <password>]
+//	gotasks migrate [up | down [steps] | status]
+//
+// mock-idp is handled by runMockIdP before the database is connected.
+func runCommand(name string, args []string, cfg *config.Config, db *mongo.Database) error {
+	switch name {
+	case "assign-orphans":
+		return assignOrphans(args, db.Collection("tasks"), db.Collection("users"), audit.NewLog(db.Collection("audit_log")))
+	case "create-admin":
+		hasher, err := newPasswordHasher(cfg.Auth.PasswordHash)
+		if err != nil {
+			return err
+		}
+		policy, err := newPasswordPolicy(cfg.Auth.PasswordPolicy)
+		if err != nil {
+			return err
+		}
+		return createAdmin(args, cfg.Admin, hasher, policy, db.Collection("users"), audit.NewLog(db.Collection("audit_log")))
+	case "migrate":
+		return migrate(args, cfg, db)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// assignOrphans hands every task created before task ownership existed to the given user,
+// and records that in the audit log.
+func assignOrphans(args []string, taskCollection, userCollection *mongo.Collection, rec audit.Recorder) error {
+	fs := flag.NewFlagSet("assign-orphans", flag.ContinueOnError)
+	owner := fs.String("owner", "", "username that will own all ownerless tasks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *owner == "" {
+		return errors.New("assign-orphans: -owner is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"username": *owner},
+		options.FindOne().SetCollation(models.UsernameCollation)).Decode(&user)
+	if err != nil {
+		return fmt.Errorf("assign-orphans: looking up user %q: %w", *owner, err)
+	}
+
+	count, err := controllers.AssignOrphanTasks(ctx, taskCollection, user.ID)
+	if err != nil {
+		return fmt.Errorf("assign-orphans: %w", err)
+	}
+
+	if count > 0 {
+		recordCommand(ctx, rec, "assign-orphans", audit.TasksReassignedEvent("", user.ID.Hex(), count))
+	}
+
+	fmt.Printf("✅ Assigned %d ownerless task(s) to %s\n", count, user.Username)
+	return nil
+}
+
+// recordCommand records e as done by command. The change has already been made,
+// so a failure to record it is only logged.
+func recordCommand(ctx context.Context, rec audit.Recorder, command string, e audit.Event) {
+	e.Actor = commandActor(command)
+	if err := rec.Record(ctx, e); err != nil {
+		log.Printf("audit: recording %s: %v", e.Action, err)
+	}
+}
+
+// registeredEvent is the audit event for an account a command created.
+func registeredEvent(user *models.User) audit.Event {
+	return audit.Event{Action: audit.Registered, TargetType: audit.TargetUser, TargetID: user.ID.Hex()}
+}
+
+// commandActor is the audit actor for changes made by a maintenance command,
+// which run without a signed-in user.
+func commandActor(command string) audit.Actor {
+	return audit.Actor{Username: "command:" + command}
+}
+
+// createAdmin creates an administrator account. The password may come from the
+// admin config (e.g. GOTASKS_ADMIN_PASSWORD) instead of the flag to keep it out
+// of shell history.
+func createAdmin(args []string, admin config.AdminConfig, hasher *passhash.Hasher, policy *passpolicy.Policy, userCollection *mongo.Collection, rec audit.Recorder) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := fs.String("username", admin.Username, "username of the new admin (defaults to the configured admin)")
+	password := fs.String("password", admin.Password, "password of the new admin (defaults to the configured admin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *password == "" {
+		return errors.New("create-admin: -username and -password are required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := handlers.CreateAdmin(ctx, userCollection, hasher, policy, *username, *password)
+	if err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+	recordCommand(ctx, rec, "create-admin", registeredEvent(user))
+
+	fmt.Printf("✅ Created admin %s (%s)\n", user.Username, user.ID.Hex())
+	return nil
+}
+
+// bootstrapAdmin creates the first admin from the admin config when it is set
+// and no admin exists yet, audited as done by "command:bootstrap-admin".
+func bootstrapAdmin(admin config.AdminConfig, hasher *passhash.Hasher, policy *passpolicy.Policy, userCollection *mongo.Collection, rec audit.Recorder) error {
+	username, password := admin.Username, admin.Password
+	if username == "" || password == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	created, err := handlers.EnsureAdmin(ctx, userCollection, hasher, policy, username, password)
+	if err != nil {
+		return fmt.Errorf("bootstrapping admin: %w", err)
+	}
+	if created != nil {
+		recordCommand(ctx, rec, "bootstrap-admin", registeredEvent(created))
+		fmt.Printf("✅ Bootstrapped admin %s\n", username)
+	}
+	return nil
+}
+
+// newMigrationRunner returns a runner for every known migration.
+func newMigrationRunner(cfg *config.Config, db *mongo.Database) (*migrations.Runner, error) {
+	return migrations.NewRunner(db, migrations.All(migrations.Legacy{
+		TaskDatabase: cfg.Mongo.LegacyTaskDatabase,
+		UserDatabase: cfg.Mongo.LegacyUserDatabase,
+	}))
+}
+
+// migrateUp applies every pending migration; it runs on startup when
+// mongo.autoMigrate is enabled.
+func migrateUp(cfg *config.Config, db *mongo.Database) error {
+	runner, err := newMigrationRunner(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	applied, err := runner.Up(ctx)
+	for _, m := range applied {
+		fmt.Printf("✅ Applied migration %d (%s)\n", m.Version, m.Name)
+	}
+	return err
+}
+
+// migrate applies, reverts or lists schema migrations.
+func migrate(args []string, cfg *config.Config, db *mongo.Database) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		return migrateUp(cfg, db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: steps must be a positive number, got %q", args[1])
+			}
+			steps = n
+		}
+
+		runner, err := newMigrationRunner(cfg, db)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		reverted, err := runner.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("↩️  Reverted migration %d (%s)\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		runner, err := newMigrationRunner(cfg, db)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-28s %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("migrate: unknown action %q (use up, down or status)", action)
+	}
+}
@@ -0,0 +1,397 @@
+// Package config loads the typed settings GoTasks runs with. Values come from
+// built-in defaults, an optional YAML or TOML file, environment variables and
+// command-line flags, each overriding the one before.
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete runtime configuration. It is built once in main and
+// handed to the packages that need it.
+type Config struct {
+	Server ServerConfig `yaml:"server" toml:"server"`
+	Mongo  MongoConfig  `yaml:"mongo" toml:"mongo"`
+	Auth   AuthConfig   `yaml:"auth" toml:"auth"`
+	Admin  AdminConfig  `yaml:"admin" toml:"admin"`
+	Mail   MailConfig   `yaml:"mail" toml:"mail"`
+	OIDC   OIDCConfig   `yaml:"oidc" toml:"oidc"`
+}
+
+type ServerConfig struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `yaml:"addr" toml:"addr"`
+	// CORSOrigins lists the browser origins allowed to call the API.
+	CORSOrigins []string `yaml:"corsOrigins" toml:"corsOrigins"`
+	// TrustedProxies lists the proxy addresses or CIDRs whose
+	// X-Forwarded-For header is believed when working out the client IP.
+	// Empty means the connection's remote address is always used.
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+}
+
+type MongoConfig struct {
+	URI string `yaml:"uri" toml:"uri"`
+	// Database holds every GoTasks collection.
+	Database string `yaml:"database" toml:"database"`
+	// LegacyTaskDatabase and LegacyUserDatabase are the databases tasks and
+	// users lived in before they were unified; migrations copy data from them.
+	LegacyTaskDatabase string `yaml:"legacyTaskDatabase" toml:"legacyTaskDatabase"`
+	LegacyUserDatabase string `yaml:"legacyUserDatabase" toml:"legacyUserDatabase"`
+	// AutoMigrate applies pending schema migrations on startup.
+	AutoMigrate bool `yaml:"autoMigrate" toml:"autoMigrate"`
+}
+
+type AuthConfig struct {
+	AccessTokenTTL  Duration `yaml:"accessTokenTTL" toml:"accessTokenTTL"`
+	RefreshTokenTTL Duration `yaml:"refreshTokenTTL" toml:"refreshTokenTTL"`
+	// Keys are "kid:ALG:path" entries; see utils.KeySpec.
+	Keys []string `yaml:"keys" toml:"keys"`
+	// ActiveKeyID is the kid new tokens are signed with; defaults to the first key.
+	ActiveKeyID string `yaml:"activeKeyID" toml:"activeKeyID"`
+	// Secret is an HS256 secret used when Keys is empty.
+	Secret  string        `yaml:"secret" toml:"secret"`
+	Lockout LockoutConfig `yaml:"lockout" toml:"lockout"`
+	// PasswordResetTTL is how long a password reset link stays valid.
+	PasswordResetTTL Duration `yaml:"passwordResetTTL" toml:"passwordResetTTL"`
+	// PasswordResetURL is the frontend page reset links point to; the token
+	// is appended as ?token=.
+	PasswordResetURL string               `yaml:"passwordResetURL" toml:"passwordResetURL"`
+	PasswordHash     PasswordHashConfig   `yaml:"passwordHash" toml:"passwordHash"`
+	PasswordPolicy   PasswordPolicyConfig `yaml:"passwordPolicy" toml:"passwordPolicy"`
+	Session          SessionConfig        `yaml:"session" toml:"session"`
+}
+
+// SessionConfig chooses how browsers hold their session.
+type SessionConfig struct {
+	// Mode is "token" to return tokens for the client to store, or "cookie"
+	// to keep them in HttpOnly cookies guarded by a double-submit CSRF token.
+	Mode string `yaml:"mode" toml:"mode"`
+	// CookieDomain is empty to scope cookies to the API host.
+	CookieDomain string `yaml:"cookieDomain" toml:"cookieDomain"`
+	CookieSecure bool   `yaml:"cookieSecure" toml:"cookieSecure"`
+	// CookieSameSite is "lax", "strict" or "none".
+	CookieSameSite string `yaml:"cookieSameSite" toml:"cookieSameSite"`
+}
+
+// CookieMode reports whether sessions are kept in cookies.
+func (c SessionConfig) CookieMode() bool {
+	return c.Mode == "cookie"
+}
+
+// PasswordPolicyConfig sets the rules new passwords must follow; see package
+// passpolicy.
+type PasswordPolicyConfig struct {
+	MinLength int `yaml:"minLength" toml:"minLength"`
+	// MinEntropy is the minimum estimated strength in bits.
+	MinEntropy     int  `yaml:"minEntropy" toml:"minEntropy"`
+	RejectUsername bool `yaml:"rejectUsername" toml:"rejectUsername"`
+	// BreachedList is a file of SHA-1 hashes of breached passwords, one per
+	// line with an optional ":count" as in the Pwned Passwords downloads.
+	BreachedList string `yaml:"breachedList" toml:"breachedList"`
+}
+
+// PasswordHashConfig chooses how new passwords are hashed; see package
+// passhash. Existing hashes are upgraded on the next successful login.
+type PasswordHashConfig struct {
+	// Algorithm is "argon2id" or "bcrypt".
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// Argon2Memory is in KiB.
+	Argon2Memory      int `yaml:"argon2Memory" toml:"argon2Memory"`
+	Argon2Time        int `yaml:"argon2Time" toml:"argon2Time"`
+	Argon2Parallelism int `yaml:"argon2Parallelism" toml:"argon2Parallelism"`
+	BcryptCost        int `yaml:"bcryptCost" toml:"bcryptCost"`
+}
+
+// LockoutConfig controls login brute-force protection; see package lockout.
+type LockoutConfig struct {
+	// Store is "memory" for a single instance or "mongo" to share failure
+	// counts between instances.
+	Store string `yaml:"store" toml:"store"`
+	// MaxFailures locks a username after that many failures in a row.
+	MaxFailures int `yaml:"maxFailures" toml:"maxFailures"`
+	// IPMaxFailures locks a client IP after that many failures.
+	IPMaxFailures int `yaml:"ipMaxFailures" toml:"ipMaxFailures"`
+	// Duration is how long a lockout lasts.
+	Duration Duration `yaml:"duration" toml:"duration"`
+}
+
+// AdminConfig holds the credentials of the admin created on first start.
+type AdminConfig struct {
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// MailConfig selects how emails such as password reset links are delivered.
+type MailConfig struct {
+	// Driver is "log" to write messages to File (or the server log when File
+	// is empty) or "smtp" to send them through SMTPAddr.
+	Driver       string `yaml:"driver" toml:"driver"`
+	From         string `yaml:"from" toml:"from"`
+	File         string `yaml:"file" toml:"file"`
+	SMTPAddr     string `yaml:"smtpAddr" toml:"smtpAddr"`
+	SMTPUsername string `yaml:"smtpUsername" toml:"smtpUsername"`
+	SMTPPassword string `yaml:"smtpPassword" toml:"smtpPassword"`
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider. It is
+// off while IssuerURL is empty.
+type OIDCConfig struct {
+	IssuerURL    string `yaml:"issuerURL" toml:"issuerURL"`
+	ClientID     string `yaml:"clientID" toml:"clientID"`
+	ClientSecret string `yaml:"clientSecret" toml:"clientSecret"`
+	// RedirectURL is the backend callback registered with the provider.
+	RedirectURL string   `yaml:"redirectURL" toml:"redirectURL"`
+	Scopes      []string `yaml:"scopes" toml:"scopes"`
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string `yaml:"groupsClaim" toml:"groupsClaim"`
+	// AdminGroups grant the admin role. UserGroups grant the user role; when
+	// empty, everyone the provider signs in becomes a user.
+	AdminGroups []string `yaml:"adminGroups" toml:"adminGroups"`
+	UserGroups  []string `yaml:"userGroups" toml:"userGroups"`
+	// FrontendCallbackURL is the frontend page that finishes the login.
+	FrontendCallbackURL string `yaml:"frontendCallbackURL" toml:"frontendCallbackURL"`
+}
+
+// Enabled reports whether single sign-on is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// Duration is a time.Duration written as a string such as "15m" in config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the settings used when nothing else is configured. They
+// match the docker-compose development setup.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:        ":8080",
+			CORSOrigins: []string{"http://localhost:3000"},
+		},
+		Mongo: MongoConfig{
+			URI:                "mongodb://mongo:27017",
+			Database:           "gotasks",
+			LegacyTaskDatabase: "gotasksdb",
+			LegacyUserDatabase: "gotasks",
+			AutoMigrate:        true,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  Duration{15 * time.Minute},
+			RefreshTokenTTL: Duration{7 * 24 * time.Hour},
+			Lockout: LockoutConfig{
+				Store:         "memory",
+				MaxFailures:   5,
+				IPMaxFailures: 50,
+				Duration:      Duration{15 * time.Minute},
+			},
+			PasswordResetTTL: Duration{time.Hour},
+			PasswordResetURL: "http://localhost:3000/reset-password",
+			PasswordHash: PasswordHashConfig{
+				Algorithm:         "argon2id",
+				Argon2Memory:      64 * 1024,
+				Argon2Time:        3,
+				Argon2Parallelism: 2,
+				BcryptCost:        12,
+			},
+			PasswordPolicy: PasswordPolicyConfig{
+				MinLength:      8,
+				MinEntropy:     40,
+				RejectUsername: true,
+			},
+			Session: SessionConfig{
+				Mode:           "token",
+				CookieSecure:   true,
+				CookieSameSite: "lax",
+			},
+		},
+		Mail: MailConfig{
+			Driver: "log",
+			From:   "GoTasks <noreply@localhost>",
+		},
+		OIDC: OIDCConfig{
+			RedirectURL:         "http://localhost:8080/api/auth/oidc/callback",
+			Scopes:              []string{"profile", "email"},
+			GroupsClaim:         "groups",
+			FrontendCallbackURL: "http://localhost:3000/sso-callback",
+		},
+	}
+}
+
+// Validate reports the first setting that cannot work.
+func (c *Config) Validate() error {
+	if c.Server.Addr == "" {
+		return fmt.Errorf("server.addr must not be empty")
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		return fmt.Errorf("server.corsOrigins must list at least one origin")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("server.corsOrigins: %q is not an http(s) origin", origin)
+		}
+	}
+
+	if !strings.HasPrefix(c.Mongo.URI, "mongodb://") && !strings.HasPrefix(c.Mongo.URI, "mongodb+srv://") {
+		return fmt.Errorf("mongo.uri must start with mongodb:// or mongodb+srv://")
+	}
+	if c.Mongo.Database == "" {
+		return fmt.Errorf("mongo.database must not be empty")
+	}
+
+	if c.Auth.AccessTokenTTL.Duration <= 0 || c.Auth.RefreshTokenTTL.Duration <= 0 {
+		return fmt.Errorf("auth token lifetimes must be positive")
+	}
+	if c.Auth.AccessTokenTTL.Duration >= c.Auth.RefreshTokenTTL.Duration {
+		return fmt.Errorf("auth.accessTokenTTL must be shorter than auth.refreshTokenTTL")
+	}
+	for _, entry := range c.Auth.Keys {
+		if len(strings.SplitN(entry, ":", 3)) != 3 {
+			return fmt.Errorf("auth.keys: entry %q is not kid:ALG:path", entry)
+		}
+	}
+	if c.Auth.Secret != "" && len(c.Auth.Secret) < 32 {
+		return fmt.Errorf("auth.secret must be at least 32 bytes")
+	}
+
+	switch c.Auth.Lockout.Store {
+	case "memory", "mongo":
+	default:
+		return fmt.Errorf("auth.lockout.store must be memory or mongo")
+	}
+	if c.Auth.Lockout.MaxFailures <= 0 || c.Auth.Lockout.IPMaxFailures <= 0 {
+		return fmt.Errorf("auth.lockout failure limits must be positive")
+	}
+	if c.Auth.Lockout.Duration.Duration <= 0 {
+		return fmt.Errorf("auth.lockout.duration must be positive")
+	}
+	if c.Auth.PasswordResetTTL.Duration <= 0 {
+		return fmt.Errorf("auth.passwordResetTTL must be positive")
+	}
+	if u, err := url.Parse(c.Auth.PasswordResetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("auth.passwordResetURL must be an http(s) URL")
+	}
+	switch hash := c.Auth.PasswordHash; hash.Algorithm {
+	case "argon2id":
+		if hash.Argon2Time < 1 || hash.Argon2Parallelism < 1 || hash.Argon2Parallelism > 255 {
+			return fmt.Errorf("auth.passwordHash: argon2Time must be positive and argon2Parallelism between 1 and 255")
+		}
+		if hash.Argon2Memory < 8*hash.Argon2Parallelism {
+			return fmt.Errorf("auth.passwordHash.argon2Memory must be at least 8 KiB per lane")
+		}
+	case "bcrypt":
+		if hash.BcryptCost < 4 || hash.BcryptCost > 31 {
+			return fmt.Errorf("auth.passwordHash.bcryptCost must be between 4 and 31")
+		}
+	default:
+		return fmt.Errorf("auth.passwordHash.algorithm must be argon2id or bcrypt")
+	}
+	if c.Auth.PasswordPolicy.MinLength < 1 || c.Auth.PasswordPolicy.MinEntropy < 0 {
+		return fmt.Errorf("auth.passwordPolicy: minLength must be positive and minEntropy not negative")
+	}
+	switch c.Auth.Session.Mode {
+	case "token", "cookie":
+	default:
+		return fmt.Errorf("auth.session.mode must be token or cookie")
+	}
+	switch c.Auth.Session.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		// Browsers drop SameSite=None cookies that are not Secure
+		if !c.Auth.Session.CookieSecure {
+			return fmt.Errorf("auth.session.cookieSameSite none requires cookieSecure")
+		}
+	default:
+		return fmt.Errorf("auth.session.cookieSameSite must be lax, strict or none")
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPAddr == "" {
+			return fmt.Errorf("mail.smtpAddr is required with the smtp driver")
+		}
+	default:
+		return fmt.Errorf("mail.driver must be log or smtp")
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		return fmt.Errorf("mail.from: %v", err)
+	}
+	if c.OIDC.Enabled() {
+		for name, value := range map[string]string{
+			"oidc.issuerURL":           c.OIDC.IssuerURL,
+			"oidc.redirectURL":         c.OIDC.RedirectURL,
+			"oidc.frontendCallbackURL": c.OIDC.FrontendCallbackURL,
+		} {
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s must be an http(s) URL", name)
+			}
+		}
+		if c.OIDC.ClientID == "" {
+			return fmt.Errorf("oidc.clientID is required when oidc.issuerURL is set")
+		}
+	}
+
+	if (c.Admin.Username == "") != (c.Admin.Password == "") {
+		return fmt.Errorf("admin.username and admin.password must be set together")
+	}
+	return nil
+}
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of c with every secret replaced by a placeholder.
+func (c *Config) Redacted() *Config {
+	out := *c
+	if out.Auth.Secret != "" {
+		out.Auth.Secret = redacted
+	}
+	if out.Admin.Password != "" {
+		out.Admin.Password = redacted
+	}
+	if out.OIDC.ClientSecret != "" {
+		out.OIDC.ClientSecret = redacted
+	}
+	if out.Mail.SMTPPassword != "" {
+		out.Mail.SMTPPassword = redacted
+	}
+	if u, err := url.Parse(out.Mongo.URI); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			out.Mongo.URI = u.String()
+		}
+	}
+	return &out
+}
+
+// WriteYAML writes c as YAML, e.g. for --print-config.
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Options are command-line settings that control this run rather than the app.
+type Options struct {
+	// ConfigFile is the YAML or TOML file that was loaded, if any.
+	ConfigFile string
+	// PrintConfig asks main to print the effective config and exit.
+	PrintConfig bool
+	// Args are the arguments left after the flags, e.g. a subcommand.
+	Args []string
+}
+
+// setting binds one config field to its environment variable and flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(string) error
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"addr", "GOTASKS_ADDR", "HTTP listen address", setString(&c.Server.Addr)},
+		{"cors-origins", "GOTASKS_CORS_ORIGINS", "comma-separated allowed CORS origins", setList(&c.Server.CORSOrigins)},
+		{"trusted-proxies", "GOTASKS_TRUSTED_PROXIES", "comma-separated proxy addresses trusted for X-Forwarded-For", setList(&c.Server.TrustedProxies)},
+		{"mongo-uri", "GOTASKS_MONGO_URI", "MongoDB connection URI", setString(&c.Mongo.URI)},
+		{"db", "GOTASKS_DB", "database holding all GoTasks data", setString(&c.Mongo.Database)},
+		{"legacy-task-db", "GOTASKS_LEGACY_TASK_DB", "pre-unification task database to migrate from", setString(&c.Mongo.LegacyTaskDatabase)},
+		{"legacy-user-db", "GOTASKS_LEGACY_USER_DB", "pre-unification user database to migrate from", setString(&c.Mongo.LegacyUserDatabase)},
+		{"auto-migrate", "GOTASKS_AUTO_MIGRATE", "apply pending migrations on startup", setBool(&c.Mongo.AutoMigrate)},
+		{"access-token-ttl", "GOTASKS_ACCESS_TOKEN_TTL", "lifetime of access tokens", setDuration(&c.Auth.AccessTokenTTL)},
+		{"refresh-token-ttl", "GOTASKS_REFRESH_TOKEN_TTL", "lifetime of refresh tokens", setDuration(&c.Auth.RefreshTokenTTL)},
+		{"jwt-keys", "JWT_KEYS", "comma-separated kid:ALG:path signing keys", setList(&c.Auth.Keys)},
+		{"jwt-active-kid", "JWT_ACTIVE_KID", "kid new tokens are signed with", setString(&c.Auth.ActiveKeyID)},
+		{"jwt-secret", "JWT_SECRET", "HS256 secret used when no keys are configured", setString(&c.Auth.Secret)},
+		{"lockout-store", "GOTASKS_LOCKOUT_STORE", "where failed logins are counted: memory or mongo", setString(&c.Auth.Lockout.Store)},
+		{"lockout-max-failures", "GOTASKS_LOCKOUT_MAX_FAILURES", "failed logins that lock a username", setInt(&c.Auth.Lockout.MaxFailures)},
+		{"lockout-ip-max-failures", "GOTASKS_LOCKOUT_IP_MAX_FAILURES", "failed logins that lock a client IP", setInt(&c.Auth.Lockout.IPMaxFailures)},
+		{"lockout-duration", "GOTASKS_LOCKOUT_DURATION", "how long a lockout lasts", setDuration(&c.Auth.Lockout.Duration)},
+		{"password-reset-ttl", "GOTASKS_PASSWORD_RESET_TTL", "lifetime of password reset links", setDuration(&c.Auth.PasswordResetTTL)},
+		{"password-reset-url", "GOTASKS_PASSWORD_RESET_URL", "frontend page password reset links open", setString(&c.Auth.PasswordResetURL)},
+		{"password-hash", "GOTASKS_PASSWORD_HASH", "algorithm new passwords are hashed with: argon2id or bcrypt", setString(&c.Auth.PasswordHash.Algorithm)},
+		{"argon2-memory", "GOTASKS_ARGON2_MEMORY", "argon2id memory in KiB", setInt(&c.Auth.PasswordHash.Argon2Memory)},
+		{"argon2-time", "GOTASKS_ARGON2_TIME", "argon2id passes over memory", setInt(&c.Auth.PasswordHash.Argon2Time)},
+		{"argon2-parallelism", "GOTASKS_ARGON2_PARALLELISM", "argon2id lanes", setInt(&c.Auth.PasswordHash.Argon2Parallelism)},
+		{"bcrypt-cost", "GOTASKS_BCRYPT_COST", "bcrypt work factor", setInt(&c.Auth.PasswordHash.BcryptCost)},
+		{"password-min-length", "GOTASKS_PASSWORD_MIN_LENGTH", "minimum password length in characters", setInt(&c.Auth.PasswordPolicy.MinLength)},
+		{"password-min-entropy", "GOTASKS_PASSWORD_MIN_ENTROPY", "minimum estimated password strength in bits", setInt(&c.Auth.PasswordPolicy.MinEntropy)},
+		{"password-reject-username", "GOTASKS_PASSWORD_REJECT_USERNAME", "refuse passwords containing the username", setBool(&c.Auth.PasswordPolicy.RejectUsername)},
+		{"breached-passwords", "GOTASKS_BREACHED_PASSWORDS", "file of SHA-1 hashes of breached passwords to refuse", setString(&c.Auth.PasswordPolicy.BreachedList)},
+		{"session-mode", "GOTASKS_SESSION_MODE", "how browsers hold sessions: token or cookie", setString(&c.Auth.Session.Mode)},
+		{"cookie-domain", "GOTASKS_COOKIE_DOMAIN", "domain of session cookies (default: the API host)", setString(&c.Auth.Session.CookieDomain)},
+		{"cookie-secure", "GOTASKS_COOKIE_SECURE", "only send session cookies over HTTPS", setBool(&c.Auth.Session.CookieSecure)},
+		{"cookie-samesite", "GOTASKS_COOKIE_SAMESITE", "SameSite attribute of session cookies: lax, strict or none", setString(&c.Auth.Session.CookieSameSite)},
+		{"admin-username", "GOTASKS_ADMIN_USERNAME", "admin created on first start", setString(&c.Admin.Username)},
+		{"admin-password", "GOTASKS_ADMIN_PASSWORD", "password of that admin", setString(&c.Admin.Password)},
+		{"mail-driver", "GOTASKS_MAIL_DRIVER", "how emails are delivered: log or smtp", setString(&c.Mail.Driver)},
+		{"mail-from", "GOTASKS_MAIL_FROM", "sender address of outgoing emails", setString(&c.Mail.From)},
+		{"mail-file", "GOTASKS_MAIL_FILE", "file the log driver appends emails to (default: server log)", setString(&c.Mail.File)},
+		{"smtp-addr", "GOTASKS_SMTP_ADDR", "SMTP server host:port", setString(&c.Mail.SMTPAddr)},
+		{"smtp-username", "GOTASKS_SMTP_USERNAME", "SMTP username", setString(&c.Mail.SMTPUsername)},
+		{"smtp-password", "GOTASKS_SMTP_PASSWORD", "SMTP password", setString(&c.Mail.SMTPPassword)},
+		{"oidc-issuer", "GOTASKS_OIDC_ISSUER", "OpenID Connect issuer URL; enables single sign-on", setString(&c.OIDC.IssuerURL)},
+		{"oidc-client-id", "GOTASKS_OIDC_CLIENT_ID", "OpenID Connect client ID", setString(&c.OIDC.ClientID)},
+		{"oidc-client-secret", "GOTASKS_OIDC_CLIENT_SECRET", "OpenID Connect client secret", setString(&c.OIDC.ClientSecret)},
+		{"oidc-redirect-url", "GOTASKS_OIDC_REDIRECT_URL", "callback URL registered with the provider", setString(&c.OIDC.RedirectURL)},
+		{"oidc-scopes", "GOTASKS_OIDC_SCOPES", "comma-separated scopes requested besides openid", setList(&c.OIDC.Scopes)},
+		{"oidc-groups-claim", "GOTASKS_OIDC_GROUPS_CLAIM", "ID token claim listing the user's groups", setString(&c.OIDC.GroupsClaim)},
+		{"oidc-admin-groups", "GOTASKS_OIDC_ADMIN_GROUPS", "comma-separated provider groups granted the admin role", setList(&c.OIDC.AdminGroups)},
+		{"oidc-user-groups", "GOTASKS_OIDC_USER_GROUPS", "comma-separated provider groups allowed to sign in (default: everyone)", setList(&c.OIDC.UserGroups)},
+		{"oidc-frontend-callback-url", "GOTASKS_OIDC_FRONTEND_CALLBACK_URL", "frontend page that finishes a single sign-on login", setString(&c.OIDC.FrontendCallbackURL)},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: defaults, the
+// file named by --config or $GOTASKS_CONFIG, environment variables and flags.
+// lookupEnv is normally os.LookupEnv. The result is validated.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	cfg := Default()
+	var opts Options
+
+	// Flags are recorded first and applied last so they win over file and env
+	type flagValue struct {
+		set   func(string) error
+		value string
+	}
+	var flagValues []flagValue
+
+	fs := flag.NewFlagSet("gotasks", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", "", "YAML or TOML config file (env GOTASKS_CONFIG)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+	for _, s := range cfg.settings() {
+		s := s
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(v string) error {
+			flagValues = append(flagValues, flagValue{set: s.set, value: v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+	opts.Args = fs.Args()
+
+	if opts.ConfigFile == "" {
+		opts.ConfigFile, _ = lookupEnv("GOTASKS_CONFIG")
+	}
+	if opts.ConfigFile != "" {
+		if err := cfg.loadFile(opts.ConfigFile); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, s := range cfg.settings() {
+		if v, ok := lookupEnv(s.env); ok {
+			if err := s.set(v); err != nil {
+				return nil, opts, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.set(fv.value); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, opts, nil
+}
+
+// loadFile merges a YAML (.yaml, .yml) or TOML (.toml) file into c. Unknown
+// keys are rejected so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		if errors.Is(err, io.EOF) {
+			err = nil // empty file
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func setString(target *string) func(string) error {
+	return func(v string) error {
+		*target = v
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*target = b
+		return nil
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*target = n
+		return nil
+	}
+}
+
+func setList(target *[]string) func(string) error {
+	return func(v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*target = items
+		return nil
+	}
+}
+
+func setDuration(target *Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		target.Duration = d
+		return nil
+	}
+}
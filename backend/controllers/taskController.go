@@ -2,9 +2,20 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
-	"gotasks/models" // Importing the Task model which defines task data
+	"gotasks/audit"      // Audit log of task changes
+	"gotasks/authz"      // Central role/permission policy
+	"gotasks/jsonpatch"  // Merge Patch and JSON Patch for PatchTask
+	"gotasks/middleware" // Access to the authenticated user set by AuthRequired
+	"gotasks/models"     // Importing the Task model which defines task data
 
 	"github.com/gin-gonic/gin"                   // Web framework for building RESTful APIs
 	"go.mongodb.org/mongo-driver/bson"           // MongoDB BSON helpers for structuring queries
@@ -25,12 +36,20 @@ type TaskCollection interface {
 	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
 	// DeleteOne deletes a single document from the collection.
 	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	// FindOneAndUpdate updates a single document and returns it, as it was before or after the update.
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	// FindOneAndDelete deletes a single document and returns it.
+	FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult
 }
 
 // Global variable to hold the injected collection object
 // This is set in the InitController function when we call it from main.go.
 var taskCol TaskCollection
 
+// auditLog records every task change; it is set with InitAudit.
+// When nil (e.g. in tests that do not care), nothing is recorded.
+var auditLog audit.Recorder
+
 // ====================
 // Controller Initialization
 // ====================
@@ -41,15 +60,98 @@ func InitController(col TaskCollection) {
 	taskCol = col
 }
 
+// InitAudit is called from main.go to record task creates, updates and deletes in the audit log
+func InitAudit(rec audit.Recorder) {
+	auditLog = rec
+}
+
+// auditTask records a change to task, with before and after being its states around the change
+// (nil for a task that did not exist before or does not exist after).
+func auditTask(c *gin.Context, action audit.Action, taskID primitive.ObjectID, before, after *models.Task) {
+	audit.RecordRequest(c, auditLog, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetTask,
+		TargetID:   taskID.Hex(),
+		Changes:    audit.Diff(before, after),
+	})
+}
+
+// ====================
+// 👤 Ownership Helpers
+// ====================
+
+// currentOwnerID returns the ObjectID of the authenticated user.
+// If the request carries no usable identity it writes a 401 response and returns false,
+// so handlers can simply bail out.
+func currentOwnerID(c *gin.Context) (primitive.ObjectID, bool) {
+	claims, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return primitive.NilObjectID, false
+	}
+	ownerID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user identity"})
+		return primitive.NilObjectID, false
+	}
+	return ownerID, true
+}
+
+// scopedTaskFilter narrows filter to the tasks the caller may perform action on,
+// according to the authz policy: users with ScopeAny (admins) see every task,
+// everyone else only their own. Scoping the query itself means another user's task
+// is indistinguishable from one that does not exist.
+// On failure it writes a 401/403 response and returns false.
+func scopedTaskFilter(c *gin.Context, action authz.Action, filter bson.D) (bson.D, bool) {
+	ownerID, ok := currentOwnerID(c)
+	if !ok {
+		return nil, false
+	}
+	claims, _ := middleware.CurrentUser(c)
+
+	switch authz.ScopeFor(claims.Role, action) {
+	case authz.ScopeAny:
+		return filter, true
+	case authz.ScopeOwn:
+		return append(filter, bson.E{Key: "ownerId", Value: ownerID}), true
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+		return nil, false
+	}
+}
+
 // ====================
 // 🚀 GetTasks Endpoint
 // ====================
 
-// GetTasks retrieves all tasks from the MongoDB collection and sends them in the response.
-// This endpoint is exposed as a GET route that returns a list of all tasks stored in the database.
+// GetTasks retrieves the tasks visible to the authenticated user and sends them in the response.
+// Regular users get their own tasks; admins get every task, optionally narrowed with ?owner=<userId>.
+// The list can be narrowed by timestamp and sorted; see taskTimeFilter and taskSort.
 func GetTasks(c *gin.Context) {
-	// Fetch all tasks from the MongoDB collection using an empty filter (bson.D{} means "all records")
-	cursor, err := taskCol.Find(context.Background(), bson.D{})
+	filter, err := taskTimeFilter(c, bson.D{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	findOptions := options.Find()
+	if sort, err := taskSort(c.Query("sort")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if sort != nil {
+		findOptions.SetSort(sort)
+	}
+
+	// Restrict the query to what the caller is allowed to read
+	filter, ok := scopedTaskFilter(c, authz.TaskRead, filter)
+	if !ok {
+		return
+	}
+	filter, ok = ownerTaskFilter(c, filter)
+	if !ok {
+		return
+	}
+
+	cursor, err := taskCol.Find(context.Background(), filter, findOptions)
 	if err != nil {
 		// If an error occurs while fetching tasks, return a 500 Internal Server Error response.
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks: " + err.Error()})
@@ -70,6 +172,96 @@ func GetTasks(c *gin.Context) {
 	c.JSON(http.StatusOK, tasks)
 }
 
+// ownerTaskFilter narrows filter, already scoped by scopedTaskFilter, to the owner named by
+// ?owner=<userId>. Only callers who may read every task can name another user; naming
+// yourself changes nothing. On failure it writes a 400 or 403 response and returns false.
+func ownerTaskFilter(c *gin.Context, filter bson.D) (bson.D, bool) {
+	owner := c.Query("owner")
+	if owner == "" {
+		return filter, true
+	}
+	ownerID, err := primitive.ObjectIDFromHex(owner)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID format"})
+		return nil, false
+	}
+
+	claims, _ := middleware.CurrentUser(c)
+	if authz.ScopeFor(claims.Role, authz.TaskRead) == authz.ScopeAny {
+		return append(filter, bson.E{Key: "ownerId", Value: ownerID}), true
+	}
+	if ownerID.Hex() != claims.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only list your own tasks"})
+		return nil, false
+	}
+	return filter, true
+}
+
+// ====================
+// 🕒 Timestamp Sorting and Filtering
+// ====================
+
+// taskTimeFields maps the names accepted in query parameters to the stored timestamp fields.
+// The "<name>After" parameters are inclusive and "<name>Before" exclusive, e.g.
+// ?completedAfter=2026-01-01T00:00:00Z&completedBefore=2026-02-01T00:00:00Z.
+var taskTimeFields = []struct{ param, field string }{
+	{"created", "createdAt"},
+	{"updated", "updatedAt"},
+	{"completed", "completedAt"},
+}
+
+// taskTimeFilter appends the timestamp conditions requested in the query string to filter.
+func taskTimeFilter(c *gin.Context, filter bson.D) (bson.D, error) {
+	for _, f := range taskTimeFields {
+		window := bson.D{}
+		for _, bound := range []struct{ suffix, operator string }{{"After", "$gte"}, {"Before", "$lt"}} {
+			raw := c.Query(f.param + bound.suffix)
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s%s must be an RFC 3339 time such as 2026-01-02T15:04:05Z", f.param, bound.suffix)
+			}
+			window = append(window, bson.E{Key: bound.operator, Value: t})
+		}
+		if len(window) > 0 {
+			filter = append(filter, bson.E{Key: f.field, Value: window})
+		}
+	}
+	return filter, nil
+}
+
+// taskSort turns ?sort=<field> into a MongoDB sort: one of createdAt, updatedAt or completedAt,
+// ascending, or descending with a leading "-" (e.g. -createdAt for newest first).
+// Ties are broken by ID so pages are stable. An empty value means no particular order.
+func taskSort(value string) (bson.D, error) {
+	if value == "" {
+		return nil, nil
+	}
+	field, direction := value, 1
+	if strings.HasPrefix(value, "-") {
+		field, direction = value[1:], -1
+	}
+	for _, f := range taskTimeFields {
+		if f.field == field {
+			return bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}, nil
+		}
+	}
+	return nil, fmt.Errorf("sort must be createdAt, updatedAt or completedAt, optionally prefixed with -")
+}
+
+// completionUpdate is the update operator that keeps completedAt in step with completed:
+// completing a task stamps it with now unless it was already completed ($min keeps the earlier,
+// existing time and sets a missing one), and reopening it removes the stamp.
+// Doing this in the update itself keeps it right when two edits race.
+func completionUpdate(completed bool, now time.Time) bson.E {
+	if completed {
+		return bson.E{Key: "$min", Value: bson.D{{Key: "completedAt", Value: now}}}
+	}
+	return bson.E{Key: "$unset", Value: bson.D{{Key: "completedAt", Value: ""}}}
+}
+
 // ====================
 // ➕ AddTask Endpoint
 // ====================
@@ -77,6 +269,17 @@ func GetTasks(c *gin.Context) {
 // AddTask allows a client to add a new task to the MongoDB collection.
 // It is exposed as a POST route, expecting a JSON payload that represents the new task.
 func AddTask(c *gin.Context) {
+	ownerID, ok := currentOwnerID(c)
+	if !ok {
+		return
+	}
+
+	// Tasks are always created for the caller, so they need write access to their own tasks
+	if claims, _ := middleware.CurrentUser(c); !authz.Allowed(claims.Role, authz.TaskWrite, true) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+		return
+	}
+
 	// Create an empty Task object to bind the incoming JSON data to
 	var newTask models.Task
 
@@ -87,6 +290,30 @@ func AddTask(c *gin.Context) {
 		return
 	}
 
+	// IDs are assigned by the server; a client-chosen one could collide or be guessed
+	if !newTask.ID.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id is assigned by the server and must not be sent"})
+		return
+	}
+
+	// Reject tasks without a title
+	if !newTask.Validate() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+		return
+	}
+
+	// Server-controlled fields: the owner always comes from the token, whatever the client sent.
+	// Timestamps are cut to milliseconds, the precision MongoDB stores, so the response matches the stored task.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	newTask.ID = primitive.NewObjectID()
+	newTask.OwnerID = ownerID
+	newTask.CreatedAt = now
+	newTask.UpdatedAt = now
+	newTask.CompletedAt = nil
+	if newTask.Completed {
+		newTask.CompletedAt = &now
+	}
+
 	// Insert the new task into the MongoDB collection
 	_, err := taskCol.InsertOne(context.Background(), newTask)
 	if err != nil {
@@ -94,9 +321,11 @@ func AddTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert task: " + err.Error()})
 		return
 	}
+	auditTask(c, audit.TaskCreated, newTask.ID, nil, &newTask)
 
-	// Successfully added the task, return it with a 201 Created status
-	// This indicates that the task has been successfully created and stored in the database
+	// Successfully added the task, return the stored task with a 201 Created status
+	// and point the Location header at it, so clients can link to it without refetching the list
+	c.Header("Location", "/tasks/"+newTask.ID.Hex())
 	c.JSON(http.StatusCreated, newTask)
 }
 
@@ -104,6 +333,10 @@ func AddTask(c *gin.Context) {
 // ✏️ EditTask Endpoint
 // ====================
 
+// EditTask replaces a task's title, description and completed flag and returns the task as stored,
+// including the server-managed fields. Anything else in the body, such as timestamps or the owner,
+// is ignored; an id that does not match the URL is rejected. Missing tasks, and tasks the caller
+// may not modify, are a 404.
 func EditTask(c *gin.Context) {
 	// Extract the task ID from the URL parameter
 	taskID := c.Param("id")
@@ -124,25 +357,312 @@ func EditTask(c *gin.Context) {
 		return
 	}
 
-	// Prepare the update query
-	filter := bson.D{{Key: "_id", Value: objectID}} // Find the task by its ID
+	// Clients often send back the whole task they fetched, so a matching id is fine
+	if !updatedTask.ID.IsZero() && updatedTask.ID != objectID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id in the body does not match the URL"})
+		return
+	}
+
+	// Reject edits that would leave the task without a title
+	if !updatedTask.Validate() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+		return
+	}
+
+	// Find the task by its ID, limited to tasks the caller may modify
+	filter, ok := scopedTaskFilter(c, authz.TaskWrite, bson.D{{Key: "_id", Value: objectID}})
+	if !ok {
+		return
+	}
+
+	// Prepare the update query; the timestamps are maintained by the server
+	now := time.Now().UTC().Truncate(time.Millisecond)
 	update := bson.D{
 		{Key: "$set", Value: bson.D{
 			{Key: "title", Value: updatedTask.Title},
 			{Key: "description", Value: updatedTask.Description},
 			{Key: "completed", Value: updatedTask.Completed},
+			{Key: "updatedAt", Value: now},
 		}},
+		completionUpdate(updatedTask.Completed, now),
+		nextVersion,
+	}
+
+	stored, ok := updateTask(c, filter, update)
+	if !ok {
+		return
 	}
 
-	// Perform the update operation
-	_, err = taskCol.UpdateOne(context.Background(), filter, update)
+	// Successfully updated the task, return it as stored
+	c.JSON(http.StatusOK, stored)
+}
+
+// updateTask applies update to the task matching filter, records the change in the audit log
+// and returns the updated task. The previous state, needed for the audit diff, is read first;
+// if the task changes in between, the diff covers both changes.
+// On failure it writes a 404 or 500 response and returns false.
+func updateTask(c *gin.Context, filter bson.D, update interface{}) (*models.Task, bool) {
+	var before models.Task
+	if err := taskCol.FindOne(context.Background(), filter).Decode(&before); err != nil {
+		taskLookupFailed(c, err, "Failed to update task: ")
+		return nil, false
+	}
+	after, err := applyTaskUpdate(c, filter, update, &before)
+	if err != nil {
+		taskLookupFailed(c, err, "Failed to update task: ")
+		return nil, false
+	}
+	return after, true
+}
+
+// applyTaskUpdate applies update to the task matching filter, audits the change from before and
+// returns the updated task. It returns mongo.ErrNoDocuments when no task matches filter.
+func applyTaskUpdate(c *gin.Context, filter bson.D, update interface{}, before *models.Task) (*models.Task, error) {
+	var after models.Task
+	err := taskCol.FindOneAndUpdate(context.Background(), filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+	if err != nil {
+		return nil, err
+	}
+
+	auditTask(c, audit.TaskUpdated, after.ID, before, &after)
+	return &after, nil
+}
+
+// taskLookupFailed answers 404 when err means there is no such task (or none the caller may see),
+// and 500 with message otherwise.
+func taskLookupFailed(c *gin.Context, err error, message string) {
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message + err.Error()})
+}
+
+// ====================
+// 🩹 PatchTask Endpoint
+// ====================
+
+// patchableTaskFields are the task fields (by JSON name) a PATCH may change; every other field
+// of models.Task is managed by the server.
+var patchableTaskFields = []string{"title", "description", "completed"}
+
+// PatchTask partially updates a task. The body is either an RFC 7396 JSON Merge Patch
+// (Content-Type: application/merge-patch+json) or an RFC 6902 JSON Patch
+// (Content-Type: application/json-patch+json), applied to the task's JSON form.
+// Only the fields the patch changes are written, and only if the task is unchanged since it was read.
+// The patched task must still be valid, and the server-managed fields (id, ownerId and the
+// timestamps) must not change. Responds with the task as stored, 404 for missing tasks,
+// 409 when a JSON Patch "test" operation fails or the task changed while the patch was being
+// applied, and 415 for other content types.
+func PatchTask(c *gin.Context) {
+	// Reject unknown formats before doing any work, and say which ones are supported
+	contentType := c.ContentType()
+	if contentType != jsonpatch.MergePatchMediaType && contentType != jsonpatch.JSONPatchMediaType {
+		c.Header("Accept-Patch", jsonpatch.MergePatchMediaType+", "+jsonpatch.JSONPatchMediaType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " +
+			jsonpatch.MergePatchMediaType + " or " + jsonpatch.JSONPatchMediaType})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID format"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	filter, ok := scopedTaskFilter(c, authz.TaskWrite, bson.D{{Key: "_id", Value: objectID}})
+	if !ok {
+		return
+	}
+
+	// The patch applies to the task as clients see it, so read it first
+	var before models.Task
+	if err := taskCol.FindOne(context.Background(), filter).Decode(&before); err != nil {
+		taskLookupFailed(c, err, "Failed to update task: ")
+		return
+	}
+	current, err := taskJSON(&before)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task: " + err.Error()})
 		return
 	}
 
-	// Successfully updated the task, return the updated task
-	c.JSON(http.StatusOK, updatedTask)
+	patched, err := patchTaskJSON(contentType, current, body)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Patch not applied: " + err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patch: " + err.Error()})
+		return
+	}
+
+	task, err := checkPatchedTask(current, patched)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := patchUpdate(current, patched, task, time.Now().UTC().Truncate(time.Millisecond))
+	if update == nil {
+		// Nothing changed, so there is nothing to write or audit
+		c.JSON(http.StatusOK, before)
+		return
+	}
+
+	// The patch was computed from before, so only write if the task still is that version
+	stored, err := applyTaskUpdate(c, unchangedSince(filter, before.Version), update, &before)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Task changed while the patch was being applied; fetch it and try again"})
+		return
+	}
+	if err != nil {
+		taskLookupFailed(c, err, "Failed to update task: ")
+		return
+	}
+	c.JSON(http.StatusOK, stored)
+}
+
+// unchangedSince narrows filter to a task still at the given version. Every update increments
+// the version (see nextVersion), so this matches only the task as it was read. Tasks that were
+// never updated have no version yet.
+func unchangedSince(filter bson.D, version int64) bson.D {
+	guard := bson.E{Key: "version", Value: version}
+	if version == 0 {
+		guard.Value = bson.M{"$exists": false}
+	}
+	return append(append(bson.D{}, filter...), guard)
+}
+
+// nextVersion is the update operator every task update includes, so that PatchTask notices
+// concurrent changes (see models.Task.Version).
+var nextVersion = bson.E{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}
+
+// taskJSON returns task as a decoded JSON object, the document patches apply to.
+func taskJSON(task *models.Task) (map[string]interface{}, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// patchTaskJSON applies the patch in body, of the given media type, to current.
+func patchTaskJSON(contentType string, current map[string]interface{}, body []byte) (map[string]interface{}, error) {
+	var result interface{}
+	if contentType == jsonpatch.MergePatchMediaType {
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, err
+		}
+		result = jsonpatch.MergePatch(current, patch)
+	} else {
+		ops, err := jsonpatch.Decode(body)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = jsonpatch.Apply(current, ops); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("a task must remain a JSON object")
+	}
+	return doc, nil
+}
+
+// checkPatchedTask makes sure a patch only changed the patchable fields of the task and left it
+// valid, and returns the patched task. Absent and null fields count as the same.
+func checkPatchedTask(current, patched map[string]interface{}) (*models.Task, error) {
+	for field := range patched {
+		if _, known := current[field]; !known {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	for field := range current {
+		if !isPatchable(field) && !reflect.DeepEqual(current[field], patched[field]) {
+			return nil, fmt.Errorf("%s is read-only", field)
+		}
+	}
+
+	data, err := json.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+	var task models.Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("Invalid task: %v", err)
+	}
+	if !task.Validate() {
+		return nil, fmt.Errorf("Title is required")
+	}
+	return &task, nil
+}
+
+func isPatchable(field string) bool {
+	for _, f := range patchableTaskFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// patchUpdate builds the MongoDB update for the fields that differ between current and patched:
+// $set for new values and $unset for removed (or null) ones, plus updatedAt and, when completed
+// changes, completedAt. It returns nil when the patch changed nothing.
+func patchUpdate(current, patched map[string]interface{}, task *models.Task, now time.Time) bson.D {
+	set, unset := bson.D{}, bson.D{}
+	completedChanged := false
+	for _, field := range patchableTaskFields {
+		if reflect.DeepEqual(current[field], patched[field]) {
+			continue
+		}
+		completedChanged = completedChanged || field == "completed"
+		if patched[field] == nil {
+			unset = append(unset, bson.E{Key: field, Value: ""})
+			continue
+		}
+		var value interface{}
+		switch field {
+		case "title":
+			value = task.Title
+		case "description":
+			value = task.Description
+		case "completed":
+			value = task.Completed
+		}
+		set = append(set, bson.E{Key: field, Value: value})
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return nil
+	}
+
+	update := bson.D{{Key: "$set", Value: append(set, bson.E{Key: "updatedAt", Value: now})}}
+	if completedChanged {
+		completion := completionUpdate(task.Completed, now)
+		if completion.Key == "$unset" {
+			// A second $unset would be a duplicate operator, so merge them
+			unset = append(unset, completion.Value.(bson.D)...)
+		} else {
+			update = append(update, completion)
+		}
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return append(update, nextVersion)
 }
 
 // ====================
@@ -160,9 +680,14 @@ func GetTaskDetail(c *gin.Context) {
 		return
 	}
 
-	// Find the task by its ID
+	// Find the task by its ID, limited to tasks the caller may read
+	filter, ok := scopedTaskFilter(c, authz.TaskRead, bson.D{{Key: "_id", Value: objectID}})
+	if !ok {
+		return
+	}
+
 	var task models.Task
-	err = taskCol.FindOne(context.Background(), bson.D{{Key: "_id", Value: objectID}}).Decode(&task)
+	err = taskCol.FindOne(context.Background(), filter).Decode(&task)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
@@ -191,19 +716,105 @@ func DeleteTask(c *gin.Context) {
 		return
 	}
 
-	// Delete the task by its ID
-	result, err := taskCol.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: objectID}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task: " + err.Error()})
+	// Delete the task by its ID, limited to tasks the caller may modify
+	filter, ok := scopedTaskFilter(c, authz.TaskWrite, bson.D{{Key: "_id", Value: objectID}})
+	if !ok {
 		return
 	}
 
-	// If no documents were matched (i.e., task not found)
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	// Delete it, keeping the deleted task for the audit log
+	var deleted models.Task
+	err = taskCol.FindOneAndDelete(context.Background(), filter).Decode(&deleted)
+	if err != nil {
+		// If no documents were matched (i.e., task not found)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task: " + err.Error()})
+		}
 		return
 	}
+	auditTask(c, audit.TaskDeleted, objectID, &deleted, nil)
 
 	// Successfully deleted the task
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted successfully"})
 }
+
+// ====================
+// 🧹 Ownerless Task Migration
+// ====================
+
+// AssignOrphanTasks gives every task that predates task ownership (no ownerId field)
+// to ownerID and returns how many tasks were updated.
+// It is run once via the "assign-orphans" command after upgrading.
+func AssignOrphanTasks(ctx context.Context, col *mongo.Collection, ownerID primitive.ObjectID) (int64, error) {
+	filter := bson.D{{Key: "ownerId", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "ownerId", Value: ownerID},
+		{Key: "updatedAt", Value: time.Now().UTC().Truncate(time.Millisecond)},
+	}}, nextVersion}
+
+	result, err := col.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ====================
+// 🗑️ Account Deletion
+// ====================
+
+// DeleteOwnerTasks removes every task owned by ownerID and returns how many were deleted.
+// It is used when an account is deleted together with its tasks.
+func DeleteOwnerTasks(ctx context.Context, col *mongo.Collection, ownerID primitive.ObjectID) (int64, error) {
+	result, err := col.DeleteMany(ctx, bson.D{{Key: "ownerId", Value: ownerID}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// TransferTasks hands every task owned by fromID to toID and returns how many were moved.
+// It is used when an account is deleted but its tasks are kept.
+func TransferTasks(ctx context.Context, col *mongo.Collection, fromID, toID primitive.ObjectID) (int64, error) {
+	filter := bson.D{{Key: "ownerId", Value: fromID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "ownerId", Value: toID},
+		{Key: "updatedAt", Value: time.Now().UTC().Truncate(time.Millisecond)},
+	}}, nextVersion}
+
+	result, err := col.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ====================
+// 📊 Task Counts
+// ====================
+
+// OwnerTaskCounts summarizes the tasks a user owns.
+type OwnerTaskCounts struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Open      int64 `json:"open"`
+}
+
+// CountOwnerTasks counts the tasks owned by ownerID, for the admin user details.
+func CountOwnerTasks(ctx context.Context, col *mongo.Collection, ownerID primitive.ObjectID) (OwnerTaskCounts, error) {
+	var counts OwnerTaskCounts
+	total, err := col.CountDocuments(ctx, bson.D{{Key: "ownerId", Value: ownerID}})
+	if err != nil {
+		return counts, err
+	}
+	completed, err := col.CountDocuments(ctx, bson.D{{Key: "ownerId", Value: ownerID}, {Key: "completed", Value: true}})
+	if err != nil {
+		return counts, err
+	}
+	counts.Total = total
+	counts.Completed = completed
+	counts.Open = total - completed
+	return counts, nil
+}
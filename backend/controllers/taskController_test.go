@@ -11,17 +11,33 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"gotasks/audit"
+	"gotasks/middleware"
 	"gotasks/models"
+	"gotasks/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// testOwnerID is the user every authenticated test request acts as
+var testOwnerID = primitive.NewObjectID()
+
+// authenticate simulates middleware.AuthRequired having accepted the request
+func authenticate(c *gin.Context) {
+	c.Set(middleware.ClaimsKey, &utils.Claims{
+		UserID:   testOwnerID.Hex(),
+		Username: "tester",
+		Role:     models.RoleUser,
+	})
+}
+
 // ===== Mock Collection =====
 
 // Mock collection simulates the MongoDB collection operations
@@ -31,6 +47,9 @@ type mockCollection struct {
 	deleteFunc  func(context.Context, interface{}, ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 	findOneFunc func(context.Context, interface{}, ...*options.FindOneOptions) *mongo.SingleResult
 	updateFunc  func(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+
+	findOneAndUpdateFunc func(context.Context, interface{}, interface{}, ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	findOneAndDeleteFunc func(context.Context, interface{}, ...*options.FindOneAndDeleteOptions) *mongo.SingleResult
 }
 
 // ===== Mock Mongo Cursor Wrapper =====
@@ -89,6 +108,34 @@ func (m *mockCollection) DeleteOne(ctx context.Context, filter interface{}, opts
 	return &mongo.DeleteResult{DeletedCount: 1}, nil
 }
 
+// Mock FindOneAndUpdate method
+func (m *mockCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	if m.findOneAndUpdateFunc != nil {
+		return m.findOneAndUpdateFunc(ctx, filter, update, opts...)
+	}
+	return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+}
+
+// Mock FindOneAndDelete method
+func (m *mockCollection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+	if m.findOneAndDeleteFunc != nil {
+		return m.findOneAndDeleteFunc(ctx, filter, opts...)
+	}
+	return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+}
+
+// ===== Fake Audit Log =====
+
+// fakeAudit collects recorded events instead of storing them
+type fakeAudit struct {
+	events []audit.Event
+}
+
+func (f *fakeAudit) Record(_ context.Context, e audit.Event) error {
+	f.events = append(f.events, e)
+	return nil
+}
+
 // Mock InsertOne method
 func (m *mockCollection) InsertOne(ctx context.Context, doc interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
 	if m.insertFunc != nil {
@@ -162,6 +209,11 @@ func TestGetTasks(t *testing.T) {
 
 	mockCol := &mockCollection{
 		findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+			expectedFilter := bson.D{{Key: "ownerId", Value: testOwnerID}}
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected filter: got %v, want %v", filter, expectedFilter)
+			}
+
 			cursor := &mockCursor{data: mockData}
 
 			// Convert []models.Task to []interface{}
@@ -179,6 +231,7 @@ func TestGetTasks(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request, _ = http.NewRequest("GET", "/tasks", nil) // Ensure the request method and path are correct
+	authenticate(c)
 	GetTasks(c)
 
 	// Check the response status code
@@ -205,20 +258,77 @@ func TestGetTasks(t *testing.T) {
 	}
 }
 
+// Test that tasks can be sorted and filtered by their timestamps
+func TestGetTasksSortAndFilter(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	InitController(&mockCollection{
+		findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+			expectedFilter := bson.D{
+				{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: from}}},
+				{Key: "completedAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+				{Key: "ownerId", Value: testOwnerID},
+			}
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected filter: got %v, want %v", filter, expectedFilter)
+			}
+			expectedSort := bson.D{{Key: "completedAt", Value: -1}, {Key: "_id", Value: -1}}
+			if len(opts) != 1 || !reflect.DeepEqual(opts[0].Sort, expectedSort) {
+				t.Errorf("unexpected sort: got %+v, want %v", opts, expectedSort)
+			}
+			return mongo.NewCursorFromDocuments(nil, nil, nil)
+		},
+	})
+
+	query := "?sort=-completedAt&createdAfter=2026-01-01T00:00:00Z" +
+		"&completedAfter=2026-01-01T00:00:00Z&completedBefore=2026-02-01T00:00:00Z"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/tasks"+query, nil)
+	authenticate(c)
+	GetTasks(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, bad := range []string{"?sort=title", "?sort=-", "?createdBefore=yesterday"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/tasks"+bad, nil)
+		authenticate(c)
+		GetTasks(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", bad, w.Code)
+		}
+	}
+}
+
 // ======= TEST: AddTask =======
 
 // Test for the AddTask endpoint
 func TestAddTask(t *testing.T) {
+	var inserted models.Task
 	mockCol := &mockCollection{
 		insertFunc: func(ctx context.Context, doc interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
-			return &mongo.InsertOneResult{}, nil
+			// The owner must come from the token, not from the request body
+			task, ok := doc.(models.Task)
+			if !ok || task.OwnerID != testOwnerID {
+				t.Errorf("expected task owned by %v, got %+v", testOwnerID, doc)
+			}
+			inserted = task
+			return &mongo.InsertOneResult{InsertedID: task.ID}, nil
 		},
 	}
 	InitController(mockCol)
+	log := &fakeAudit{}
+	InitAudit(log)
+	defer InitAudit(nil)
 
 	task := models.Task{
 		Title:       "Unit Test Task",
 		Description: "AddTask test case",
+		OwnerID:     primitive.NewObjectID(), // Attempt to create a task for someone else
 	}
 	body, _ := json.Marshal(task)
 
@@ -226,6 +336,7 @@ func TestAddTask(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request, _ = http.NewRequest("POST", "/tasks", bytes.NewReader(body))
 	c.Request.Header.Set("Content-Type", "application/json")
+	authenticate(c)
 	AddTask(c)
 
 	if w.Code != http.StatusCreated {
@@ -237,6 +348,59 @@ func TestAddTask(t *testing.T) {
 	if err != nil || result.Title != task.Title {
 		t.Fatalf("unexpected response body: %s", w.Body.String())
 	}
+
+	// The response is the stored task, with the server-assigned fields
+	if result.ID.IsZero() || result.ID != inserted.ID {
+		t.Errorf("expected the generated ID %v in the response, got %v", inserted.ID, result.ID)
+	}
+	if result.CreatedAt.IsZero() || !result.CreatedAt.Equal(inserted.CreatedAt) || !result.UpdatedAt.Equal(inserted.CreatedAt) {
+		t.Errorf("expected matching server timestamps, got created %v updated %v, stored %v",
+			result.CreatedAt, result.UpdatedAt, inserted.CreatedAt)
+	}
+	if location := w.Header().Get("Location"); location != "/tasks/"+inserted.ID.Hex() {
+		t.Errorf("expected Location /tasks/%s, got %q", inserted.ID.Hex(), location)
+	}
+	if result.CompletedAt != nil {
+		t.Errorf("expected an open task to have no completedAt, got %v", result.CompletedAt)
+	}
+
+	if len(log.events) != 1 || log.events[0].Action != audit.TaskCreated || log.events[0].Actor.UserID != testOwnerID.Hex() {
+		t.Fatalf("expected one task.created event by the caller, got %+v", log.events)
+	}
+}
+
+// Test that AddTask refuses blank titles and client-chosen IDs without storing anything
+func TestAddTaskRejectsInvalidTasks(t *testing.T) {
+	InitController(&mockCollection{
+		insertFunc: func(ctx context.Context, doc interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+			t.Errorf("InsertOne should not be called, got %+v", doc)
+			return &mongo.InsertOneResult{}, nil
+		},
+	})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "blank title", body: `{"title": "   ", "description": "no title"}`},
+		{name: "missing title", body: `{"description": "no title"}`},
+		{name: "client ID", body: `{"id": "` + primitive.NewObjectID().Hex() + `", "title": "Mine"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/tasks", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			authenticate(c)
+			AddTask(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 Bad Request, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
 }
 
 // ======= TEST: EditTask =======
@@ -244,28 +408,55 @@ func TestAddTask(t *testing.T) {
 // Test for the EditTask endpoint
 func TestEditTask(t *testing.T) {
 	originalID := primitive.NewObjectID()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	edited := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	expectedFilter := bson.D{{Key: "_id", Value: originalID}, {Key: "ownerId", Value: testOwnerID}}
 
 	mockCol := &mockCollection{
-		updateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
-			// ✅ Simulate a successful update
-			return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
-		},
 		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-			// ✅ Simulate the updated task being returned
-			mockDoc := bson.M{
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected filter: got %v, want %v", filter, expectedFilter)
+			}
+			// ✅ Simulate the task as it was before the edit
+			return mongo.NewSingleResultFromDocument(bson.M{
 				"_id":         originalID,
-				"title":       "Updated Task",
+				"title":       "Original Task",
 				"description": "Updated description",
+				"ownerId":     testOwnerID,
+				"createdAt":   created,
+				"updatedAt":   created,
+			}, nil, nil)
+		},
+		findOneAndUpdateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected filter: got %v, want %v", filter, expectedFilter)
 			}
-			return mongo.NewSingleResultFromDocument(mockDoc, nil, nil)
+			if len(opts) != 1 || opts[0].ReturnDocument == nil || *opts[0].ReturnDocument != options.After {
+				t.Errorf("expected the updated document to be returned, got %+v", opts)
+			}
+			// ✅ Simulate the stored task after the update
+			return mongo.NewSingleResultFromDocument(bson.M{
+				"_id":         originalID,
+				"title":       "Updated Task",
+				"description": "Updated description",
+				"ownerId":     testOwnerID,
+				"createdAt":   created,
+				"updatedAt":   edited,
+			}, nil, nil)
 		},
 	}
 	InitController(mockCol)
+	log := &fakeAudit{}
+	InitAudit(log)
+	defer InitAudit(nil)
 
-	// Prepare request body
+	// Prepare request body; server-managed fields sent by the client are ignored
 	updatedTask := models.Task{
+		ID:          originalID,
 		Title:       "Updated Task",
 		Description: "Updated description",
+		OwnerID:     primitive.NewObjectID(),
+		CreatedAt:   time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC),
 	}
 	body, _ := json.Marshal(updatedTask)
 
@@ -277,6 +468,7 @@ func TestEditTask(t *testing.T) {
 
 	// 👇 This is crucial
 	c.Params = gin.Params{gin.Param{Key: "id", Value: originalID.Hex()}}
+	authenticate(c)
 
 	// Act
 	EditTask(c)
@@ -292,8 +484,344 @@ func TestEditTask(t *testing.T) {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	if result.Title != updatedTask.Title || result.Description != updatedTask.Description {
-		t.Errorf("unexpected task: got %+v, want %+v", result, updatedTask)
+	// The response is the stored task, not the request body
+	if result.ID != originalID || result.Title != updatedTask.Title || result.OwnerID != testOwnerID ||
+		!result.CreatedAt.Equal(created) || !result.UpdatedAt.Equal(edited) {
+		t.Errorf("unexpected task: got %+v", result)
+	}
+
+	// Only the title changed, besides the server's updatedAt
+	if len(log.events) != 1 || log.events[0].Action != audit.TaskUpdated {
+		t.Fatalf("expected one task.updated event, got %+v", log.events)
+	}
+	changes := log.events[0].Changes
+	if len(changes) != 2 || changes[0] != (audit.Change{Field: "title", Before: "Original Task", After: "Updated Task"}) || changes[1].Field != "updatedAt" {
+		t.Fatalf("expected title and updatedAt changes, got %+v", changes)
+	}
+}
+
+// Test that EditTask rejects invalid edits without touching the database
+func TestEditTaskRejectsInvalidEdits(t *testing.T) {
+	InitController(&mockCollection{
+		findOneAndUpdateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+			t.Errorf("FindOneAndUpdate should not be called, got %v", update)
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+		},
+	})
+
+	taskID := primitive.NewObjectID()
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "blank title", body: `{"title": " ", "completed": true}`},
+		{name: "other ID", body: `{"id": "` + primitive.NewObjectID().Hex() + `", "title": "Task"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PUT", "/tasks/"+taskID.Hex(), strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+			authenticate(c)
+			EditTask(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 Bad Request, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// Test that editing a task that does not exist (or is not the caller's) is a 404
+func TestEditMissingTask(t *testing.T) {
+	InitController(&mockCollection{
+		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+		},
+	})
+	log := &fakeAudit{}
+	InitAudit(log)
+	defer InitAudit(nil)
+
+	taskID := primitive.NewObjectID()
+	body, _ := json.Marshal(models.Task{Title: "Updated Task"})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("PUT", "/tasks/"+taskID.Hex(), bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+	authenticate(c)
+	EditTask(c)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 Not Found, got %d", w.Code)
+	}
+	if len(log.events) != 0 {
+		t.Fatalf("expected nothing audited, got %+v", log.events)
+	}
+}
+
+// Test that completing a task stamps completedAt unless it is already set, and reopening it clears it
+func TestEditTaskCompletion(t *testing.T) {
+	taskID := primitive.NewObjectID()
+
+	tests := []struct {
+		name       string
+		completed  bool
+		wantUpdate string
+	}{
+		{name: "completing", completed: true, wantUpdate: "$min"},
+		{name: "reopening", completed: false, wantUpdate: "$unset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := bson.M{"_id": taskID, "title": "Task", "completed": tt.completed}
+			InitController(&mockCollection{
+				findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+					return mongo.NewSingleResultFromDocument(bson.M{"_id": taskID, "title": "Task"}, nil, nil)
+				},
+				findOneAndUpdateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+					ops, _ := update.(bson.D)
+					want := bson.E{Key: tt.wantUpdate, Value: bson.D{{Key: "completedAt", Value: ""}}}
+					if tt.wantUpdate == "$min" {
+						if len(ops) == 3 {
+							want.Value = ops[1].Value
+						}
+						if stamp, ok := want.Value.(bson.D); !ok || len(stamp) != 1 || stamp[0].Key != "completedAt" {
+							t.Errorf("expected $min on completedAt, got %v", ops)
+						}
+					}
+					if len(ops) != 3 || !reflect.DeepEqual(ops[1], want) || !reflect.DeepEqual(ops[2], nextVersion) {
+						t.Errorf("unexpected completion update: got %v, want %v", ops, want)
+					}
+					return mongo.NewSingleResultFromDocument(stored, nil, nil)
+				},
+			})
+
+			body, _ := json.Marshal(models.Task{Title: "Task", Completed: tt.completed})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PUT", "/tasks/"+taskID.Hex(), bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+			authenticate(c)
+			EditTask(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// Test that PatchTask translates both patch formats into targeted updates and rejects bad patches
+func TestPatchTask(t *testing.T) {
+	taskID := primitive.NewObjectID()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stored := bson.M{
+		"_id":         taskID,
+		"title":       "Write report",
+		"description": "Quarterly numbers",
+		"ownerId":     testOwnerID,
+		"createdAt":   created,
+		"updatedAt":   created,
+		"version":     int64(3),
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		// wantOps lists the update operators and the fields each must touch, in order
+		wantOps []string
+	}{
+		{
+			name:        "merge patch completes the task",
+			contentType: "application/merge-patch+json",
+			body:        `{"completed": true}`,
+			wantStatus:  http.StatusOK,
+			wantOps:     []string{"$set completed updatedAt", "$min completedAt", "$inc version"},
+		},
+		{
+			name:        "merge patch removes the description",
+			contentType: "application/merge-patch+json",
+			body:        `{"title": "Write summary", "description": null}`,
+			wantStatus:  http.StatusOK,
+			wantOps:     []string{"$set title updatedAt", "$unset description", "$inc version"},
+		},
+		{
+			name:        "JSON Patch with a passing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/title", "value": "Write report"}, {"op": "replace", "path": "/description", "value": "Yearly numbers"}]`,
+			wantStatus:  http.StatusOK,
+			wantOps:     []string{"$set description updatedAt", "$inc version"},
+		},
+		{
+			name:        "unchanged read-only fields are fine",
+			contentType: "application/merge-patch+json",
+			body:        `{"id": "` + taskID.Hex() + `", "completedAt": null, "completed": false}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "failing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/title", "value": "Something else"}, {"op": "remove", "path": "/description"}]`,
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name:        "read-only field",
+			contentType: "application/merge-patch+json",
+			body:        `{"ownerId": "` + primitive.NewObjectID().Hex() + `"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "removing a read-only field",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "remove", "path": "/createdAt"}]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/merge-patch+json",
+			body:        `{"priority": 1}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "blank title",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/title", "value": " "}]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "wrong type",
+			contentType: "application/merge-patch+json",
+			body:        `{"completed": "yes"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "invalid JSON Patch",
+			contentType: "application/json-patch+json",
+			body:        `{"completed": true}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "plain JSON",
+			contentType: "application/json",
+			body:        `{"completed": true}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOps []string
+			InitController(&mockCollection{
+				findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+					return mongo.NewSingleResultFromDocument(stored, nil, nil)
+				},
+				findOneAndUpdateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+					wantFilter := bson.D{{Key: "_id", Value: taskID}, {Key: "ownerId", Value: testOwnerID}, {Key: "version", Value: int64(3)}}
+					if !reflect.DeepEqual(filter, wantFilter) {
+						t.Errorf("unexpected filter: got %v, want %v", filter, wantFilter)
+					}
+					for _, op := range update.(bson.D) {
+						fields := op.Key
+						for _, e := range op.Value.(bson.D) {
+							fields += " " + e.Key
+						}
+						gotOps = append(gotOps, fields)
+					}
+					return mongo.NewSingleResultFromDocument(stored, nil, nil)
+				},
+			})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PATCH", "/tasks/"+taskID.Hex(), strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+			authenticate(c)
+			PatchTask(c)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if !reflect.DeepEqual(gotOps, tt.wantOps) {
+				t.Errorf("unexpected update: got %q, want %q", gotOps, tt.wantOps)
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Patch") == "" {
+				t.Error("expected an Accept-Patch header")
+			}
+		})
+	}
+}
+
+// Test that patching a task that does not exist (or is not the caller's) is a 404
+func TestPatchMissingTask(t *testing.T) {
+	InitController(&mockCollection{
+		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+		},
+	})
+
+	taskID := primitive.NewObjectID()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("PATCH", "/tasks/"+taskID.Hex(), strings.NewReader(`{"completed": true}`))
+	c.Request.Header.Set("Content-Type", "application/merge-patch+json")
+	c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+	authenticate(c)
+	PatchTask(c)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 Not Found, got %d", w.Code)
+	}
+}
+
+// Test that a patch is not written over a change made after the task was read, which the
+// version guard in the filter makes FindOneAndUpdate miss
+func TestPatchTaskChangedMeanwhile(t *testing.T) {
+	taskID := primitive.NewObjectID()
+	InitController(&mockCollection{
+		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.M{"_id": taskID, "title": "Write report", "ownerId": testOwnerID,
+				"version": int64(1)}, nil, nil)
+		},
+		findOneAndUpdateFunc: func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+			// Another request has updated the task since, so the guarded filter matches nothing
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+		},
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("PATCH", "/tasks/"+taskID.Hex(), strings.NewReader(`{"completed": true}`))
+	c.Request.Header.Set("Content-Type", "application/merge-patch+json")
+	c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+	authenticate(c)
+	PatchTask(c)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// Test that a task that was never updated is only patched while it still has no version
+func TestUnchangedSinceNewTask(t *testing.T) {
+	filter := bson.D{{Key: "_id", Value: primitive.NewObjectID()}}
+	got := unchangedSince(filter, 0)
+	want := append(bson.D{}, filter[0], bson.E{Key: "version", Value: bson.M{"$exists": false}})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unchangedSince() = %v, want %v", got, want)
+	}
+	if len(filter) != 1 {
+		t.Error("unchangedSince must not modify the filter it is given")
 	}
 }
 
@@ -312,7 +840,7 @@ func TestGetTaskDetail(t *testing.T) {
 	mockCol := &mockCollection{
 		findOneFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
 			// Validate filter if you want:
-			expectedFilter := bson.D{{Key: "_id", Value: objectID}}
+			expectedFilter := bson.D{{Key: "_id", Value: objectID}, {Key: "ownerId", Value: testOwnerID}}
 			if !reflect.DeepEqual(filter, expectedFilter) {
 				t.Errorf("unexpected filter: got %v, want %v", filter, expectedFilter)
 			}
@@ -334,6 +862,7 @@ func TestGetTaskDetail(t *testing.T) {
 	c.Request, _ = http.NewRequest("GET", "/tasks/"+objectID.Hex(), nil)
 	// This is crucial for extracting :id
 	c.Params = gin.Params{gin.Param{Key: "id", Value: objectID.Hex()}}
+	authenticate(c)
 
 	// Call the controller
 	GetTaskDetail(c)
@@ -365,8 +894,8 @@ func TestDeleteTask(t *testing.T) {
 	objectID, _ := primitive.ObjectIDFromHex(validID)
 
 	mockCol := &mockCollection{
-		deleteFunc: func(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-			expectedFilter := bson.D{{Key: "_id", Value: objectID}} // Match the type used in real code
+		findOneAndDeleteFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+			expectedFilter := bson.D{{Key: "_id", Value: objectID}, {Key: "ownerId", Value: testOwnerID}} // Match the type used in real code
 
 			// Convert both to bson.D to compare properly
 			actualFilter, ok := filter.(bson.D)
@@ -378,15 +907,19 @@ func TestDeleteTask(t *testing.T) {
 				t.Errorf("unexpected filter: got %v, want %v", actualFilter, expectedFilter)
 			}
 
-			return &mongo.DeleteResult{DeletedCount: 1}, nil
+			return mongo.NewSingleResultFromDocument(bson.M{"_id": objectID, "title": "Doomed", "ownerId": testOwnerID}, nil, nil)
 		},
 	}
 	InitController(mockCol)
+	log := &fakeAudit{}
+	InitAudit(log)
+	defer InitAudit(nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request, _ = http.NewRequest("DELETE", "/tasks/"+validID, nil)
 	c.Params = gin.Params{gin.Param{Key: "id", Value: validID}}
+	authenticate(c)
 
 	DeleteTask(c)
 
@@ -398,4 +931,114 @@ func TestDeleteTask(t *testing.T) {
 	if strings.TrimSpace(w.Body.String()) != expected {
 		t.Errorf("unexpected response body: got %s, want %s", w.Body.String(), expected)
 	}
+
+	if len(log.events) != 1 || log.events[0].Action != audit.TaskDeleted || log.events[0].TargetID != validID {
+		t.Fatalf("expected one task.deleted event for %s, got %+v", validID, log.events)
+	}
+}
+
+// ======= TEST: Unauthenticated access =======
+
+// Test that handlers refuse to run without an authenticated user on the context
+func TestTaskHandlersRequireUser(t *testing.T) {
+	InitController(&mockCollection{
+		findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+			t.Error("Find should not be called without an authenticated user")
+			return nil, nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/tasks", nil)
+	GetTasks(c)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 Unauthorized, got %d", w.Code)
+	}
+}
+
+// ======= TEST: Admin scope =======
+
+// Test that admins are not limited to their own tasks
+func TestAdminTaskScope(t *testing.T) {
+	otherOwner := primitive.NewObjectID()
+	taskID := primitive.NewObjectID()
+
+	InitController(&mockCollection{
+		findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+			expectedFilter := bson.D{{Key: "ownerId", Value: otherOwner}}
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected list filter: got %v, want %v", filter, expectedFilter)
+			}
+			return mongo.NewCursorFromDocuments(nil, nil, nil)
+		},
+		findOneAndDeleteFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+			expectedFilter := bson.D{{Key: "_id", Value: taskID}}
+			if !reflect.DeepEqual(filter, expectedFilter) {
+				t.Errorf("unexpected delete filter: got %v, want %v", filter, expectedFilter)
+			}
+			return mongo.NewSingleResultFromDocument(bson.M{"_id": taskID, "ownerId": otherOwner}, nil, nil)
+		},
+	})
+
+	asAdmin := func(c *gin.Context) {
+		c.Set(middleware.ClaimsKey, &utils.Claims{UserID: testOwnerID.Hex(), Username: "root", Role: models.RoleAdmin})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/tasks?owner="+otherOwner.Hex(), nil)
+	asAdmin(c)
+	GetTasks(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK listing another user's tasks, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("DELETE", "/tasks/"+taskID.Hex(), nil)
+	c.Params = gin.Params{gin.Param{Key: "id", Value: taskID.Hex()}}
+	asAdmin(c)
+	DeleteTask(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK deleting another user's task, got %d", w.Code)
+	}
+}
+
+// Test that ?owner= cannot widen a regular user's list: naming someone else is refused, and
+// naming themselves keeps the single ownerId condition
+func TestUserOwnerQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		owner      string
+		wantStatus int
+	}{
+		{"another user", primitive.NewObjectID().Hex(), http.StatusForbidden},
+		{"themselves", testOwnerID.Hex(), http.StatusOK},
+		{"invalid ID", "not-an-id", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitController(&mockCollection{
+				findFunc: func(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+					expectedFilter := bson.D{{Key: "ownerId", Value: testOwnerID}}
+					if !reflect.DeepEqual(filter, expectedFilter) {
+						t.Errorf("unexpected list filter: got %v, want %v", filter, expectedFilter)
+					}
+					return mongo.NewCursorFromDocuments(nil, nil, nil)
+				},
+			})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/tasks?owner="+tt.owner, nil)
+			authenticate(c)
+			GetTasks(c)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
 }
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotasks/authz"
+	"gotasks/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultAccessTokenLifetime applies when no expiry is requested.
+	defaultAccessTokenLifetime = 30 * 24 * time.Hour
+	// maxAccessTokenLifetime caps how long a token can live, so forgotten
+	// tokens do not stay valid forever.
+	maxAccessTokenLifetime = 365 * 24 * time.Hour
+)
+
+// CreateAccessToken issues a personal access token for scripts and CI. The
+// plain token is only in this response.
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 1 to 100 characters"})
+		return
+	}
+
+	var scopes []string
+	seen := map[string]bool{}
+	for _, scope := range body.Scopes {
+		if !authz.IsTokenScope(authz.Action(scope)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope, "allowedScopes": authz.TokenScopes})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required", "allowedScopes": authz.TokenScopes})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultAccessTokenLifetime)
+	if body.ExpiresAt != nil {
+		expiresAt = *body.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.Sub(now) > maxAccessTokenLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future and at most a year away"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, record, err := h.AccessTokens.Create(ctx, userID, name, scopes, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Copy this token now; it will not be shown again",
+		"token":       token,
+		"accessToken": record,
+	})
+}
+
+// ListAccessTokens returns the caller's unexpired tokens with when each was
+// last used, but never the tokens themselves.
+func (h *AuthHandler) ListAccessTokens(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := h.AccessTokens.List(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeAccessToken deletes one of the caller's tokens.
+func (h *AuthHandler) RevokeAccessToken(c *gin.Context) {
+	tokenID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID format"})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := h.AccessTokens.Revoke(ctx, userID, tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// currentUserID returns the authenticated caller's ID, answering 401 when
+// there is none.
+func currentUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	claims, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return primitive.NilObjectID, false
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user identity"})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotasks/audit"
+	"gotasks/controllers"
+	"gotasks/lockout"
+	"gotasks/mail"
+	"gotasks/middleware"
+	"gotasks/models"
+	"gotasks/store"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page sizes for ListUsers.
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// AdminHandler serves the /api/admin user-management endpoints. Like
+// AuthHandler it is built in main with every field set.
+type AdminHandler struct {
+	UserCollection *mongo.Collection
+	// TaskCollection is needed for task counts and to delete or hand over
+	// a deleted user's tasks.
+	TaskCollection *mongo.Collection
+	Lockout        *lockout.Guard
+	RefreshTokens  *store.RefreshTokenStore
+	Revocations    *store.RevocationStore
+	AccessTokens   *store.AccessTokenStore
+	PasswordResets *store.PasswordResetStore
+	Mailer         mail.Mailer
+	// PasswordResetURL is the frontend page reset links point to.
+	PasswordResetURL string
+	// Audit records what admins do and serves the audit log endpoints.
+	Audit *audit.Log
+}
+
+// ListUsers returns one page of users without their password hashes, sorted
+// by username. Query parameters narrow the list: q matches part of the
+// username, email or display name, role is "admin" or "user", and status is
+// "active" or "disabled". page counts from 1; limit is at most 100.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, err := positiveQueryInt(c, "page", 1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := positiveQueryInt(c, "limit", defaultUserPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit > maxUserPageSize {
+		limit = maxUserPageSize
+	}
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"username": pattern},
+			bson.M{"email": pattern},
+			bson.M{"displayName": pattern},
+		}
+	}
+	switch role := strings.ToLower(c.Query("role")); role {
+	case "":
+	case models.RoleAdmin, models.RoleUser:
+		filter["role"] = role
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be either 'admin' or 'user'"})
+		return
+	}
+	switch status := strings.ToLower(c.Query("status")); status {
+	case "":
+	case "active":
+		filter["disabled"] = bson.M{"$ne": true}
+	case "disabled":
+		filter["disabled"] = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be either 'active' or 'disabled'"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, err := h.UserCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"password": 0, "totp": 0}).
+		SetSort(bson.D{{Key: "username", Value: 1}}).
+		SetCollation(models.UsernameCollation).
+		SetSkip(int64(page-1) * int64(limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := h.UserCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total, "page": page, "limit": limit})
+}
+
+// GetUser returns one user's account together with how many tasks they own.
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	counts, err := controllers.CountOwnerTasks(ctx, h.TaskCollection, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count tasks"})
+		return
+	}
+
+	details := gin.H{
+		"twoFactorEnabled": user.TwoFactorEnabled(),
+		"hasPassword":      user.Password != "",
+		"singleSignOn":     len(user.Identities) > 0,
+		"tasks":            counts,
+	}
+	details["user"] = sanitizedUser(user)
+	c.JSON(http.StatusOK, details)
+}
+
+// SetRole promotes or demotes a user. Admins cannot change their own role, and
+// the last remaining admin cannot be demoted, so the system always keeps one.
+// Tokens carry the role, so the user is signed out everywhere and the new role
+// applies from their next login.
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	role := strings.ToLower(strings.TrimSpace(body.Role))
+	if role != models.RoleAdmin && role != models.RoleUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be either 'admin' or 'user'"})
+		return
+	}
+
+	if isSelf(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	if role == user.Role {
+		c.JSON(http.StatusOK, sanitizedUser(user))
+		return
+	}
+	err := updateKeepingAnAdmin(ctx, h.UserCollection, user,
+		bson.M{"$set": bson.M{"role": role}}, bson.M{"$set": bson.M{"role": user.Role}})
+	if err != nil {
+		adminChangeFailed(c, err, "Cannot demote the last admin", "Failed to update role")
+		return
+	}
+	h.auditUser(c, audit.RoleChanged, user, []audit.Change{{Field: "role", Before: user.Role, After: role}})
+	if err := h.revokeSessions(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Role changed, but existing sessions could not be revoked"})
+		return
+	}
+
+	user.Role = role
+	c.JSON(http.StatusOK, sanitizedUser(user))
+}
+
+// Unlock lifts a login lockout on a user before it expires and clears their
+// failed-attempt count.
+func (h *AdminHandler) Unlock(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := h.Lockout.Unlock(ctx, user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// Disable stops a user from logging in and signs them out everywhere. Their
+// personal access tokens are kept but rejected while the account is
+// disabled. Admins cannot disable themselves or the last enabled admin.
+func (h *AdminHandler) Disable(c *gin.Context) {
+	if isSelf(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot disable your own account"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+	err := updateKeepingAnAdmin(ctx, h.UserCollection, user,
+		bson.M{"$set": bson.M{"disabled": true}}, bson.M{"$unset": bson.M{"disabled": ""}})
+	if err != nil {
+		adminChangeFailed(c, err, "Cannot disable the last admin", "Failed to disable user")
+		return
+	}
+	h.auditUser(c, audit.UserDisabled, user, []audit.Change{{Field: "disabled", Before: user.Disabled, After: true}})
+	if err := h.revokeSessions(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User disabled, but existing sessions could not be revoked"})
+		return
+	}
+
+	user.Disabled = true
+	c.JSON(http.StatusOK, sanitizedUser(user))
+}
+
+// Enable lets a disabled user log in again.
+func (h *AdminHandler) Enable(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"disabled": ""}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+		return
+	}
+	h.auditUser(c, audit.UserEnabled, user, []audit.Change{{Field: "disabled", Before: user.Disabled, After: false}})
+
+	user.Disabled = false
+	c.JSON(http.StatusOK, sanitizedUser(user))
+}
+
+// ForcePasswordReset makes a user choose a new password: their password no
+// longer logs them in, every session and personal access token is revoked,
+// and a reset link is mailed to them. For accounts without an email the
+// link is returned instead, for the admin to pass on.
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account signs in through single sign-on and has no password"})
+		return
+	}
+
+	if _, err := h.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"passwordResetRequired": true}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to require a password reset"})
+		return
+	}
+	h.auditUser(c, audit.PasswordResetForced, user,
+		[]audit.Change{{Field: "passwordResetRequired", Before: user.PasswordResetRequired, After: true}})
+	if err := h.revokeSessions(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset required, but existing sessions could not be revoked"})
+		return
+	}
+	if err := h.AccessTokens.RevokeUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset required, but existing sessions could not be revoked"})
+		return
+	}
+
+	link, err := issueResetLink(ctx, h.PasswordResets, h.PasswordResetURL, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset required, but no reset link could be issued"})
+		return
+	}
+
+	if user.Email == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Password reset required; the user has no email, so pass them this link",
+			"emailed":  false,
+			"resetUrl": link,
+		})
+		return
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Choose a new GoTasks password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"An administrator has asked you to choose a new password for your GoTasks account. "+
+			"Until you do, your old password no longer works. To choose a new one, open:\n\n"+
+			"%s\n\n"+
+			"The link works once and expires in %s.\n",
+			user.Username, link, h.PasswordResets.TTL()),
+	}
+	if err := h.Mailer.Send(ctx, msg); err != nil {
+		log.Printf("admin: mailing reset link to %s: %v", user.ID.Hex(), err)
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Password reset required, but the email could not be sent; pass the user this link",
+			"emailed":  false,
+			"resetUrl": link,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required; a reset link was emailed to the user", "emailed": true})
+}
+
+// DeleteUser deletes a user. As with DELETE /api/auth/me, the body chooses
+// what happens to their tasks: {"tasks": "delete"} removes them,
+// {"tasks": "reassign", "reassignTo": "<username>"} hands them to another
+// user. Admins delete their own account through /api/auth/me, and the last
+// admin cannot be deleted.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	var body struct {
+		Tasks      string `json:"tasks"`
+		ReassignTo string `json:"reassignTo"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.Tasks != tasksDelete && body.Tasks != tasksReassign {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tasks must be 'delete' or 'reassign'"})
+		return
+	}
+
+	if isSelf(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Delete your own account through /api/auth/me"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.loadUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	reassignTo := primitive.NilObjectID
+	if body.Tasks == tasksReassign {
+		var target models.User
+		err := h.UserCollection.FindOne(ctx, bson.M{"username": strings.TrimSpace(body.ReassignTo)},
+			options.FindOne().SetCollation(models.UsernameCollation)).Decode(&target)
+		if errors.Is(err, mongo.ErrNoDocuments) || target.ID == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must name another existing user"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		reassignTo = target.ID
+	}
+
+	tasks, err := deleteAccountKeepingAnAdmin(ctx, h.UserCollection, h.TaskCollection, user, reassignTo)
+	if err != nil {
+		adminChangeFailed(c, err, "The last admin cannot be deleted", "Failed to delete user")
+		return
+	}
+	auditAccountDeletion(c, h.Audit, user, reassignTo, tasks)
+	// The account is already gone, so revocation failures are only logged
+	if err := h.revokeSessions(ctx, user.ID); err != nil {
+		log.Printf("admin: revoking sessions of deleted user %s: %v", user.ID.Hex(), err)
+	}
+	if err := h.AccessTokens.RevokeUser(ctx, user.ID); err != nil {
+		log.Printf("admin: revoking personal access tokens of deleted user %s: %v", user.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "tasks": body.Tasks, "taskCount": tasks})
+}
+
+// auditUser records an admin action on user.
+func (h *AdminHandler) auditUser(c *gin.Context, action audit.Action, user *models.User, changes []audit.Change) {
+	audit.RecordRequest(c, h.Audit, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID.Hex(),
+		Changes:    changes,
+	})
+}
+
+// loadUser fetches the user named by the :id route parameter, answering 400
+// or 404 when there is none.
+func (h *AdminHandler) loadUser(ctx context.Context, c *gin.Context) (*models.User, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return nil, false
+	}
+
+	var user models.User
+	err = h.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// revokeSessions signs a user out of every login: their access tokens stop
+// working and their refresh tokens are revoked.
+func (h *AdminHandler) revokeSessions(ctx context.Context, userID primitive.ObjectID) error {
+	if err := h.Revocations.RevokeAll(ctx, userID.Hex(), time.Now()); err != nil {
+		return err
+	}
+	return h.RefreshTokens.RevokeUser(ctx, userID)
+}
+
+// isSelf reports whether the :id route parameter names the caller.
+func isSelf(c *gin.Context) bool {
+	claims, ok := middleware.CurrentUser(c)
+	return ok && claims.UserID == c.Param("id")
+}
+
+// sanitizedUser drops the password hash from user before it is sent out.
+func sanitizedUser(user *models.User) *models.User {
+	user.Password = ""
+	return user
+}
+
+// positiveQueryInt reads an optional positive integer query parameter.
+func positiveQueryInt(c *gin.Context, name string, fallback int) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
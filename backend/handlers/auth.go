@@ -2,24 +2,59 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"gotasks/audit"
+	"gotasks/lockout"
+	"gotasks/mail"
+	"gotasks/middleware"
 	"gotasks/models"
+	"gotasks/passhash"
+	"gotasks/passpolicy"
+	"gotasks/sso"
+	"gotasks/store"
 	"gotasks/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// AuthHandler serves the /api/auth endpoints. It is built in main with every
+// field set.
 type AuthHandler struct {
 	UserCollection *mongo.Collection
-}
-
-func NewAuthHandler(userCollection *mongo.Collection) *AuthHandler {
-	return &AuthHandler{UserCollection: userCollection}
+	// TaskCollection is needed to delete or hand over an account's tasks.
+	TaskCollection *mongo.Collection
+	Passwords      *passhash.Hasher
+	PasswordPolicy *passpolicy.Policy
+	Tokens         *utils.JWTManager
+	RefreshTokens  *store.RefreshTokenStore
+	Revocations    *store.RevocationStore
+	Lockout        *lockout.Guard
+	PasswordResets *store.PasswordResetStore
+	// ResetRequests limits how often reset links are mailed per email and IP.
+	ResetRequests *lockout.Guard
+	Mailer        mail.Mailer
+	// PasswordResetURL is the frontend page reset links point to.
+	PasswordResetURL string
+	AccessTokens     *store.AccessTokenStore
+	// SSO is nil when single sign-on is not configured.
+	SSO       *sso.Client
+	SSOLogins *store.SSOLoginStore
+	// SSOCallbackURL is the frontend page that finishes a single sign-on login.
+	SSOCallbackURL string
+	// Cookies is nil unless cookie session mode is on.
+	Cookies *SessionCookies
+	// Audit records registrations and login attempts.
+	Audit audit.Recorder
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -31,33 +66,76 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Public sign-up always creates a regular user; admins are created with the
+	// create-admin command or promoted by another admin
+	user.ID = primitive.NilObjectID
+	user.Role = models.RoleUser
+	user.Disabled = false
+	user.PasswordResetRequired = false
+
 	// Validate input
 	if err := user.Validate(); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.PasswordPolicy.Check(user.Password, user.Username); err != nil {
+		passwordRejected(c, err)
+		return
+	}
 
 	// Hash password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
+	if err := hashUserPassword(h.Passwords, &user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error securing password"})
 		return
 	}
-	user.Password = string(hashed)
 
 	// Save to DB
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = h.UserCollection.InsertOne(ctx, user)
+	result, err := h.UserCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken", "code": ErrCodeUsernameTaken})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		audit.RecordRequest(c, h.Audit, audit.Event{
+			Action:     audit.Registered,
+			Actor:      audit.Actor{UserID: id.Hex(), Username: user.Username},
+			TargetType: audit.TargetUser,
+			TargetID:   id.Hex(),
+		})
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
+// UsernameAvailable tells the sign-up form whether a username is still free,
+// using the same case-insensitive comparison as the unique index.
+func (h *AuthHandler) UsernameAvailable(c *gin.Context) {
+	username, err := models.NormalizeUsername(c.Query("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := h.UserCollection.CountDocuments(ctx, bson.M{"username": username},
+		options.Count().SetCollation(models.UsernameCollation).SetLimit(1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check username"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"username": username, "available": count == 0})
+}
+
 func (h *AuthHandler) Login(c *gin.Context) {
 	var creds struct {
 		Username string `json:"username"`
@@ -73,31 +151,372 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := h.UserCollection.FindOne(ctx, bson.M{"username": creds.Username}).Decode(&user)
+	// Refuse throttled or locked attempts before spending time on hashing
+	username := strings.TrimSpace(creds.Username)
+	decision, err := h.Lockout.Check(ctx, username, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process login"})
+		return
+	}
+	if !decision.Allowed() {
+		reason := ErrCodeLoginThrottled
+		if decision.Locked {
+			reason = ErrCodeAccountLocked
+		}
+		h.auditLogin(c, username, nil, reason)
+		tooManyAttempts(c, decision)
+		return
+	}
+
+	err = h.UserCollection.FindOne(ctx, bson.M{"username": username},
+		options.FindOne().SetCollation(models.UsernameCollation)).Decode(&user)
+	if err != nil {
+		// Hash anyway, so an unknown username answers as slowly as a wrong password
+		h.Passwords.VerifyDecoy(creds.Password)
+		h.loginFailed(ctx, c, username, nil)
 		return
 	}
 
 	// Compare hashed password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+	match, rehash, err := h.Passwords.Verify(creds.Password, user.Password)
+	if err != nil {
+		log.Printf("login: cannot verify password hash of %s: %v", user.ID.Hex(), err)
+	}
+	if !match {
+		h.loginFailed(ctx, c, username, &user)
+		return
+	}
+	if rehash {
+		h.upgradePasswordHash(ctx, &user, creds.Password)
+	}
+
+	// Only a correct password learns that the account is disabled or must
+	// reset its password, so these answers reveal nothing to guessers
+	if !h.accountUsable(c, username, &user) {
+		return
+	}
+
+	// With two-factor enabled the password only earns a challenge; failure
+	// counts are kept until the second factor succeeds, so a known password
+	// cannot be used to keep resetting them while guessing codes
+	if user.TwoFactorEnabled() {
+		challenge, err := h.Tokens.GenerateChallenge(user.ID.Hex(), user.Username, challengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":           "Two-factor code required",
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"expiresIn":         int(challengeTTL.Seconds()),
+		})
+		return
+	}
+
+	if err := h.Lockout.Success(ctx, username); err != nil {
+		log.Printf("lockout: could not reset failures for %q: %v", username, err)
+	}
+
+	refreshToken, err := h.RefreshTokens.Issue(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	h.auditLogin(c, username, &user, "")
+	h.respondWithTokens(c, http.StatusOK, "Login successful", &user, refreshToken)
+}
+
+// loginFailed counts a failed attempt against the username and client IP and
+// answers 401. Unknown usernames count too, so lockouts reveal nothing about
+// which accounts exist. user is the account the username named, if any.
+func (h *AuthHandler) loginFailed(ctx context.Context, c *gin.Context, username string, user *models.User) {
+	if err := h.Lockout.Failure(ctx, username, c.ClientIP()); err != nil {
+		log.Printf("lockout: could not record failure for %q: %v", username, err)
+	}
+	h.auditLogin(c, username, user, reasonInvalidCredentials)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+}
+
+// reasonInvalidCredentials is the audit reason for a wrong username or password.
+const reasonInvalidCredentials = "invalid_credentials"
+
+// auditLogin records a login attempt with the username that was tried and,
+// when known, the account it names. An empty reason means it succeeded;
+// otherwise reason says why it was refused, usually as an error code.
+func (h *AuthHandler) auditLogin(c *gin.Context, username string, user *models.User, reason string) {
+	e := audit.Event{Action: audit.LoginSucceeded, Actor: audit.Actor{Username: username}, Reason: reason}
+	if user != nil {
+		e.TargetType = audit.TargetUser
+		e.TargetID = user.ID.Hex()
+		// Only a successful login proves who the actor is
+		if reason == "" {
+			e.Actor = audit.Actor{UserID: user.ID.Hex(), Username: user.Username}
+		}
+	}
+	if reason != "" {
+		e.Action = audit.LoginFailed
+	}
+	audit.RecordRequest(c, h.Audit, e)
+}
+
+// accountUsable checks the account states that stop a password login even
+// with the right credentials: a disabled account, or a password reset an admin
+// required. It answers 403 and audits the attempt when one applies. Every
+// step of a login that ends in tokens runs it, since an admin may act between
+// steps.
+func (h *AuthHandler) accountUsable(c *gin.Context, username string, user *models.User) bool {
+	if user.Disabled {
+		h.auditLogin(c, username, user, ErrCodeAccountDisabled)
+		accountDisabled(c)
+		return false
+	}
+	if user.PasswordResetRequired {
+		h.auditLogin(c, username, user, ErrCodePasswordResetRequired)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "An administrator requires you to choose a new password; use the reset link sent to your email",
+			"code":  ErrCodePasswordResetRequired,
+		})
+		return false
+	}
+	return true
+}
+
+// accountDisabled answers 403 for an account an admin has disabled.
+func accountDisabled(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled", "code": ErrCodeAccountDisabled})
+}
+
+// tooManyAttempts answers 429 with a Retry-After header in whole seconds.
+func tooManyAttempts(c *gin.Context, decision lockout.Decision) {
+	seconds := retryAfter(c, decision)
+
+	body := gin.H{"error": "Too many failed login attempts; try again later", "code": ErrCodeLoginThrottled, "retryAfter": seconds}
+	if decision.Locked {
+		body["error"] = "Account temporarily locked after too many failed login attempts"
+		body["code"] = ErrCodeAccountLocked
+	}
+	c.JSON(http.StatusTooManyRequests, body)
+}
+
+// retryAfter sets the Retry-After header for decision and returns its value
+// in whole seconds.
+func retryAfter(c *gin.Context, decision lockout.Decision) int {
+	seconds := int((decision.RetryAfter + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return seconds
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. The presented token is consumed; replaying it revokes every token
+// descended from the same login. In cookie mode the token comes from the
+// refresh cookie and the request must carry the CSRF token.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	// The body is optional in cookie mode
+	_ = c.ShouldBindJSON(&body)
+	if body.RefreshToken == "" && h.Cookies != nil {
+		if cookie, err := c.Cookie(middleware.RefreshCookie); err == nil && cookie != "" {
+			if !middleware.ValidCSRF(c) {
+				middleware.CSRFRejected(c)
+				return
+			}
+			body.RefreshToken = cookie
+		}
+	}
+	if body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, refreshToken, err := h.RefreshTokens.Rotate(ctx, body.RefreshToken)
+	if err != nil {
+		switch err {
+		case store.ErrRefreshTokenReused:
+			h.clearSessionCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected; please log in again"})
+		case store.ErrRefreshTokenInvalid:
+			h.clearSessionCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		}
+		return
+	}
+
+	// Reload the user so role changes apply to the new access token
+	var user models.User
+	if err := h.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		_ = h.RefreshTokens.RevokeUser(ctx, userID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if user.Disabled {
+		_ = h.RefreshTokens.RevokeUser(ctx, userID)
+		h.clearSessionCookies(c)
+		accountDisabled(c)
+		return
+	}
+
+	h.respondWithTokens(c, http.StatusOK, "Token refreshed", &user, refreshToken)
+}
+
+// Logout revokes the access token used for this request and, when the client
+// sends it, the refresh token from the same login.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, _ := middleware.CurrentUser(c)
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&body)
+	if body.RefreshToken == "" && h.Cookies != nil {
+		body.RefreshToken, _ = c.Cookie(middleware.RefreshCookie)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.Revocations.RevokeToken(ctx, claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+	if body.RefreshToken != "" {
+		if err := h.RefreshTokens.RevokeFamily(ctx, body.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+			return
+		}
+	}
+
+	h.clearSessionCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll invalidates every access token the user was issued before the
+// given time (default: now) and all of their refresh tokens, signing them out
+// on every device.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	claims, _ := middleware.CurrentUser(c)
+
+	var body struct {
+		Before *time.Time `json:"before"`
+	}
+	_ = c.ShouldBindJSON(&body)
+
+	now := time.Now()
+	before := now
+	if body.Before != nil && body.Before.Before(now) {
+		before = *body.Before
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user identity"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without an explicit time, tokens issued in this very second go too
+	revoke := h.Revocations.RevokeAllBefore
+	if before.Equal(now) {
+		revoke = h.Revocations.RevokeAll
+	}
+	if err := revoke(ctx, claims.UserID, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+	if err := h.RefreshTokens.RevokeUser(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.Username, user.Role)
+	h.clearSessionCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "before": before.UTC().Format(time.RFC3339)})
+}
+
+// respondWithTokens signs an access token for user and writes it together
+// with refreshToken in the shape returned by Login. In cookie mode the tokens
+// go into cookies instead and the body carries the CSRF token.
+func (h *AuthHandler) respondWithTokens(c *gin.Context, status int, message string, user *models.User, refreshToken string) {
+	token, err := h.Tokens.GenerateJWT(user.ID.Hex(), user.Username, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
+	body := gin.H{
+		"message":   message,
+		"expiresIn": int(h.Tokens.TTL().Seconds()),
 		"user": gin.H{
 			"id":       user.ID.Hex(),
 			"username": user.Username,
 			"role":     user.Role,
 		},
+	}
+	if h.Cookies != nil {
+		csrf, err := h.setSessionCookies(c, token, refreshToken)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		body["csrfToken"] = csrf
+	} else {
+		body["token"] = token
+		body["refreshToken"] = refreshToken
+	}
+	c.JSON(status, body)
+}
+
+// passwordRejected answers 400 with every password policy rule err reports
+// as broken, so forms can show them next to the password field.
+func passwordRejected(c *gin.Context, err error) {
+	var policyErr *passpolicy.Error
+	if !errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the requirements: " + policyErr.Error(),
+		"code":       ErrCodeWeakPassword,
+		"violations": policyErr.Violations,
 	})
 }
+
+// hashUserPassword replaces the user's plain-text password with its hash.
+func hashUserPassword(hasher *passhash.Hasher, user *models.User) error {
+	hashed, err := hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	return nil
+}
+
+// upgradePasswordHash re-hashes a just-verified password whose stored hash
+// uses an outdated algorithm or parameters. The update only applies while the
+// old hash is still stored, so it cannot undo a concurrent password change.
+// Failures are logged; the login goes ahead either way.
+func (h *AuthHandler) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	hashed, err := h.Passwords.Hash(password)
+	if err != nil {
+		log.Printf("login: re-hashing password of %s: %v", user.ID.Hex(), err)
+		return
+	}
+	_, err = h.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hashed}})
+	if err != nil {
+		log.Printf("login: storing re-hashed password of %s: %v", user.ID.Hex(), err)
+		return
+	}
+	user.Password = hashed
+}
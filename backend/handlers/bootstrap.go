@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gotasks/models"
+	"gotasks/passhash"
+	"gotasks/passpolicy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrUsernameTaken is returned by CreateAdmin when the username already exists.
+var ErrUsernameTaken = errors.New("username already exists")
+
+// CreateAdmin stores a new administrator account. It backs the "create-admin"
+// command and the startup bootstrap, the only ways to create an admin without
+// an existing one.
+func CreateAdmin(ctx context.Context, userCollection *mongo.Collection, hasher *passhash.Hasher, policy *passpolicy.Policy, username, password string) (*models.User, error) {
+	user := models.User{Username: username, Password: password, Role: models.RoleAdmin}
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	if err := policy.Check(user.Password, user.Username); err != nil {
+		return nil, err
+	}
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"username": user.Username},
+		options.Count().SetCollation(models.UsernameCollation))
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrUsernameTaken
+	}
+
+	if err := hashUserPassword(hasher, &user); err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+
+	result, err := userCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		user.ID = id
+	}
+	return &user, nil
+}
+
+// EnsureAdmin creates an administrator from the given credentials unless at
+// least one admin already exists. It returns the account it created, or nil.
+func EnsureAdmin(ctx context.Context, userCollection *mongo.Collection, hasher *passhash.Hasher, policy *passpolicy.Policy, username, password string) (*models.User, error) {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"role": models.RoleAdmin})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	return CreateAdmin(ctx, userCollection, hasher, policy, username, password)
+}
@@ -0,0 +1,18 @@
+package handlers
+
+// Machine-readable error codes returned in the "code" field of error
+// responses, so clients do not have to match on messages.
+const (
+	ErrCodeUsernameTaken         = "username_taken"
+	ErrCodeLoginThrottled        = "login_throttled"
+	ErrCodeAccountLocked         = "account_locked"
+	ErrCodeResetTokenInvalid     = "reset_token_invalid"
+	ErrCodeResetThrottled        = "reset_throttled"
+	ErrCodeChallengeInvalid      = "challenge_invalid"
+	ErrCodeInvalidTOTPCode       = "invalid_2fa_code"
+	ErrCodeWeakPassword          = "weak_password"
+	ErrCodeInvalidPassword       = "invalid_password"
+	ErrCodeLastAdmin             = "last_admin"
+	ErrCodeAccountDisabled       = "account_disabled"
+	ErrCodePasswordResetRequired = "password_reset_required"
+)
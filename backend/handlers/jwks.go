@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS serves the public signing keys at /.well-known/jwks.json so other
+// services can verify GoTasks tokens without sharing a secret.
+func JWKS(tokens *utils.JWTManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, tokens.JWKS())
+	}
+}
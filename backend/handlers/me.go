@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotasks/audit"
+	"gotasks/controllers"
+	"gotasks/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What DeleteMe does with the deleted user's tasks.
+const (
+	tasksDelete   = "delete"
+	tasksReassign = "reassign"
+)
+
+// GetMe returns the caller's own account.
+func (h *AuthHandler) GetMe(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// UpdateMe changes the caller's profile. Only the fields sent are touched,
+// and an empty string clears a field. Changing the email, which receives
+// password reset links, needs the current password.
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	var body struct {
+		DisplayName     *string `json:"displayName"`
+		Email           *string `json:"email"`
+		Timezone        *string `json:"timezone"`
+		Locale          *string `json:"locale"`
+		AvatarURL       *string `json:"avatarUrl"`
+		CurrentPassword string  `json:"currentPassword"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	var newEmail string
+	set, unset := bson.M{}, bson.M{}
+	fields := []struct {
+		key       string
+		value     *string
+		normalize func(string) (string, error)
+	}{
+		{"displayName", body.DisplayName, models.NormalizeDisplayName},
+		{"email", body.Email, normalizeOptionalEmail},
+		{"timezone", body.Timezone, models.NormalizeTimezone},
+		{"locale", body.Locale, models.NormalizeLocale},
+		{"avatarUrl", body.AvatarURL, models.NormalizeAvatarURL},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		value, err := f.normalize(*f.value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if f.key == "email" {
+			newEmail = value
+		}
+		if value == "" {
+			unset[f.key] = ""
+		} else {
+			set[f.key] = value
+		}
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No profile fields to update"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	emailChanged := body.Email != nil && newEmail != user.Email
+	if emailChanged && user.Password != "" && !h.confirmPassword(ctx, c, user, body.CurrentPassword) {
+		return
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	var updated models.User
+	err := h.UserCollection.FindOneAndUpdate(ctx, bson.M{"_id": user.ID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profileResponse(&updated))
+}
+
+// ChangePassword replaces the caller's password after checking the current
+// one. Every other session is signed out; the caller gets a fresh token pair.
+// Personal access tokens are kept.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var body struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account signs in through single sign-on and has no password"})
+		return
+	}
+	if !h.confirmPassword(ctx, c, user, body.CurrentPassword) {
+		return
+	}
+	if err := h.PasswordPolicy.Check(body.NewPassword, user.Username); err != nil {
+		passwordRejected(c, err)
+		return
+	}
+
+	oldHash := user.Password
+	user.Password = body.NewPassword
+	if err := hashUserPassword(h.Passwords, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error securing password"})
+		return
+	}
+	// Matching the old hash keeps two concurrent changes from both succeeding
+	res, err := h.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "password": oldHash},
+		bson.M{"$set": bson.M{"password": user.Password}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Password was changed by another request; please try again"})
+		return
+	}
+
+	// The caller gets a new token right away, which an inclusive cut-off would revoke too
+	if err := h.Revocations.RevokeAllBefore(ctx, user.ID.Hex(), time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but existing sessions could not be revoked"})
+		return
+	}
+	if err := h.RefreshTokens.RevokeUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but existing sessions could not be revoked"})
+		return
+	}
+
+	refreshToken, err := h.RefreshTokens.Issue(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed; please log in again"})
+		return
+	}
+	h.respondWithTokens(c, http.StatusOK, "Password changed", user, refreshToken)
+}
+
+// DeleteMe deletes the caller's account after checking their password. The
+// body chooses what happens to their tasks: {"tasks": "delete"} removes them,
+// {"tasks": "reassign", "reassignTo": "<username>"} hands them to another
+// user. The last admin cannot delete their account.
+func (h *AuthHandler) DeleteMe(c *gin.Context) {
+	var body struct {
+		Password   string `json:"password"`
+		Tasks      string `json:"tasks"`
+		ReassignTo string `json:"reassignTo"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.Tasks != tasksDelete && body.Tasks != tasksReassign {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tasks must be 'delete' or 'reassign'"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	// Accounts that only sign in through single sign-on have no password to confirm
+	if user.Password != "" && !h.confirmPassword(ctx, c, user, body.Password) {
+		return
+	}
+
+	reassignTo := primitive.NilObjectID
+	if body.Tasks == tasksReassign {
+		var target models.User
+		err := h.UserCollection.FindOne(ctx, bson.M{"username": strings.TrimSpace(body.ReassignTo)},
+			options.FindOne().SetCollation(models.UsernameCollation)).Decode(&target)
+		if errors.Is(err, mongo.ErrNoDocuments) || target.ID == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must name another existing user"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		reassignTo = target.ID
+	}
+
+	tasks, err := deleteAccountKeepingAnAdmin(ctx, h.UserCollection, h.TaskCollection, user, reassignTo)
+	if err != nil {
+		adminChangeFailed(c, err, "The last admin cannot be deleted", "Failed to delete account")
+		return
+	}
+	auditAccountDeletion(c, h.Audit, user, reassignTo, tasks)
+	h.revokeAllCredentials(ctx, user)
+
+	h.clearSessionCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted", "tasks": body.Tasks, "taskCount": tasks})
+}
+
+// confirmPassword re-checks the caller's password before a sensitive change,
+// answering 403 when it is wrong. Wrong passwords count towards the login
+// lockout, so a stolen session cannot be used to guess the password.
+func (h *AuthHandler) confirmPassword(ctx context.Context, c *gin.Context, user *models.User, password string) bool {
+	decision, err := h.Lockout.Check(ctx, user.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify password"})
+		return false
+	}
+	if !decision.Allowed() {
+		tooManyAttempts(c, decision)
+		return false
+	}
+
+	match, _, err := h.Passwords.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("me: cannot verify password hash of %s: %v", user.ID.Hex(), err)
+	}
+	if !match {
+		if err := h.Lockout.Failure(ctx, user.Username, c.ClientIP()); err != nil {
+			log.Printf("lockout: could not record failure for %q: %v", user.Username, err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect", "code": ErrCodeInvalidPassword})
+		return false
+	}
+	return true
+}
+
+// revokeAllCredentials signs a deleted account out everywhere. The account
+// is already gone, so failures are only logged.
+func (h *AuthHandler) revokeAllCredentials(ctx context.Context, user *models.User) {
+	if err := h.Revocations.RevokeAll(ctx, user.ID.Hex(), time.Now()); err != nil {
+		log.Printf("me: revoking access tokens of deleted user %s: %v", user.ID.Hex(), err)
+	}
+	if err := h.RefreshTokens.RevokeUser(ctx, user.ID); err != nil {
+		log.Printf("me: revoking refresh tokens of deleted user %s: %v", user.ID.Hex(), err)
+	}
+	if err := h.AccessTokens.RevokeUser(ctx, user.ID); err != nil {
+		log.Printf("me: revoking personal access tokens of deleted user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// deleteAccount removes a user and then deletes their tasks or, when
+// reassignTo is set, hands them over. It returns how many tasks were
+// affected. The user goes first: if the task step fails, the leftover tasks
+// are ownerless rather than the account surviving without them.
+func deleteAccount(ctx context.Context, users, tasks *mongo.Collection, userID, reassignTo primitive.ObjectID) (int64, error) {
+	if _, err := users.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		return 0, err
+	}
+	if reassignTo.IsZero() {
+		return controllers.DeleteOwnerTasks(ctx, tasks, userID)
+	}
+	return controllers.TransferTasks(ctx, tasks, userID, reassignTo)
+}
+
+// auditAccountDeletion records the deletion of user, by themselves or an
+// admin, and what deleteAccount did with their tasks.
+func auditAccountDeletion(c *gin.Context, rec audit.Recorder, user *models.User, reassignTo primitive.ObjectID, tasks int64) {
+	audit.RecordRequest(c, rec, audit.Event{
+		Action:     audit.UserDeleted,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID.Hex(),
+		Changes:    audit.Diff(sanitizedUser(user), nil),
+	})
+	if reassignTo.IsZero() {
+		audit.RecordRequest(c, rec, audit.TasksDeletedEvent(user.ID.Hex(), tasks))
+	} else {
+		audit.RecordRequest(c, rec, audit.TasksReassignedEvent(user.ID.Hex(), reassignTo.Hex(), tasks))
+	}
+}
+
+// errLastAdmin is returned when a change would leave no enabled admin.
+var errLastAdmin = errors.New("no enabled admin would be left")
+
+// enabledAdmins matches the admins who can sign in to manage the system.
+// Disabled admins do not count.
+var enabledAdmins = bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}}
+
+// updateKeepingAnAdmin applies update, which may demote or disable user, and
+// reverts it with undo if that left no enabled admin, returning errLastAdmin.
+// The admins are counted after the update rather than before: two concurrent
+// changes could otherwise each see the other admin and together remove both,
+// whereas this way at least the later one sees none left and is undone.
+func updateKeepingAnAdmin(ctx context.Context, users *mongo.Collection, user *models.User, update, undo bson.M) error {
+	if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return err
+	}
+	if user.Role != models.RoleAdmin || user.Disabled {
+		return nil
+	}
+
+	admins, err := users.CountDocuments(ctx, enabledAdmins)
+	if err == nil && admins > 0 {
+		return nil
+	}
+	if _, undoErr := users.UpdateOne(ctx, bson.M{"_id": user.ID}, undo); undoErr != nil {
+		return errors.Join(err, undoErr)
+	}
+	if err != nil {
+		return err
+	}
+	return errLastAdmin
+}
+
+// deleteAccountKeepingAnAdmin is deleteAccount for a user who may be the last
+// enabled admin. The account is disabled through updateKeepingAnAdmin first,
+// so it stops counting as an admin before it is deleted, and enabled again if
+// the deletion fails.
+func deleteAccountKeepingAnAdmin(ctx context.Context, users, tasks *mongo.Collection, user *models.User, reassignTo primitive.ObjectID) (int64, error) {
+	disable, enable := bson.M{"$set": bson.M{"disabled": true}}, bson.M{"$unset": bson.M{"disabled": ""}}
+	if err := updateKeepingAnAdmin(ctx, users, user, disable, enable); err != nil {
+		return 0, err
+	}
+	count, err := deleteAccount(ctx, users, tasks, user.ID, reassignTo)
+	if err != nil && !user.Disabled {
+		if _, undoErr := users.UpdateOne(ctx, bson.M{"_id": user.ID}, enable); undoErr != nil {
+			log.Printf("enabling %s again after a failed deletion: %v", user.ID.Hex(), undoErr)
+		}
+	}
+	return count, err
+}
+
+// adminChangeFailed answers 409 with message when err is errLastAdmin, and
+// 500 with failure otherwise.
+func adminChangeFailed(c *gin.Context, err error, message, failure string) {
+	if errors.Is(err, errLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": message, "code": ErrCodeLastAdmin})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+}
+
+// normalizeOptionalEmail is models.NormalizeEmail that also accepts an empty
+// address, which removes the email.
+func normalizeOptionalEmail(email string) (string, error) {
+	if strings.TrimSpace(email) == "" {
+		return "", nil
+	}
+	return models.NormalizeEmail(email)
+}
+
+// profileResponse is the shape of the caller's own account in /me responses.
+func profileResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":               user.ID.Hex(),
+		"username":         user.Username,
+		"role":             user.Role,
+		"email":            user.Email,
+		"displayName":      user.DisplayName,
+		"timezone":         user.Timezone,
+		"locale":           user.Locale,
+		"avatarUrl":        user.AvatarURL,
+		"twoFactorEnabled": user.TwoFactorEnabled(),
+		"hasPassword":      user.Password != "",
+		"singleSignOn":     len(user.Identities) > 0,
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gotasks/mail"
+	"gotasks/models"
+	"gotasks/store"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ForgotPassword emails a reset link to every account registered with the
+// given address. The response is the same whether or not any account
+// matched, and mail is sent in the background, so the endpoint cannot be used
+// to find out which addresses are registered. Requests are limited per
+// address and client IP, registered or not, and answered 429 beyond that.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	email, err := models.NormalizeEmail(body.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Every request counts, so the limit applies before anything is sent
+	decision, err := h.ResetRequests.Check(ctx, email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process request"})
+		return
+	}
+	if !decision.Allowed() {
+		seconds := retryAfter(c, decision)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many reset requests; try again later", "code": ErrCodeResetThrottled, "retryAfter": seconds})
+		return
+	}
+	if err := h.ResetRequests.Failure(ctx, email, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process request"})
+		return
+	}
+
+	go h.sendResetLinks(email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account uses that email, a reset link is on its way"})
+}
+
+// sendResetLinks issues a reset token for each account using email and mails
+// it. Accounts without a password sign in through single sign-on and are
+// skipped, as ForcePasswordReset refuses them too. Failures are only logged;
+// the client has already been answered.
+func (h *AuthHandler) sendResetLinks(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := h.UserCollection.Find(ctx, bson.M{"email": email, "password": bson.M{"$gt": ""}},
+		options.Find().SetProjection(bson.M{"username": 1, "email": 1}).SetLimit(10))
+	if err != nil {
+		log.Printf("password reset: looking up %q: %v", email, err)
+		return
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Printf("password reset: looking up %q: %v", email, err)
+		return
+	}
+
+	for _, user := range users {
+		link, err := issueResetLink(ctx, h.PasswordResets, h.PasswordResetURL, user.ID)
+		if err != nil {
+			log.Printf("password reset: issuing token for %s: %v", user.ID.Hex(), err)
+			continue
+		}
+
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: "Reset your GoTasks password",
+			Body: fmt.Sprintf("Hi %s,\n\n"+
+				"Someone asked to reset the password of your GoTasks account. To choose a new one, open:\n\n"+
+				"%s\n\n"+
+				"The link works once and expires in %s. If you did not ask for this, you can ignore this email.\n",
+				user.Username, link, h.PasswordResets.TTL()),
+		}
+		if err := h.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("password reset: mailing %s: %v", user.ID.Hex(), err)
+		}
+	}
+}
+
+// issueResetLink issues a reset token for userID and returns the link to
+// the frontend page that redeems it.
+func issueResetLink(ctx context.Context, resets *store.PasswordResetStore, pageURL string, userID primitive.ObjectID) (string, error) {
+	token, err := resets.Issue(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return pageURL + "?token=" + url.QueryEscape(token), nil
+}
+
+// ResetPassword sets a new password using a token from a reset email. The
+// token is used up, and every existing session and personal access token of
+// the account is revoked so a thief who knew the old password is locked out.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Token) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Check the password first so a rejected one does not burn the token
+	token := strings.TrimSpace(body.Token)
+	userID, err := h.PasswordResets.Lookup(ctx, token)
+	if errors.Is(err, store.ErrResetTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link", "code": ErrCodeResetTokenInvalid})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reset password"})
+		return
+	}
+	var owner models.User
+	err = h.UserCollection.FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"username": 1, "password": 1})).Decode(&owner)
+	if err != nil || owner.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link", "code": ErrCodeResetTokenInvalid})
+		return
+	}
+	if err := h.PasswordPolicy.Check(body.Password, owner.Username); err != nil {
+		passwordRejected(c, err)
+		return
+	}
+
+	user := models.User{Password: body.Password}
+	if err := hashUserPassword(h.Passwords, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error securing password"})
+		return
+	}
+
+	consumedBy, err := h.PasswordResets.Consume(ctx, token)
+	if errors.Is(err, store.ErrResetTokenInvalid) || (err == nil && consumedBy != userID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link", "code": ErrCodeResetTokenInvalid})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reset password"})
+		return
+	}
+
+	var updated models.User
+	err = h.UserCollection.FindOneAndUpdate(ctx, bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password": user.Password}, "$unset": bson.M{"passwordResetRequired": ""}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"username": 1}),
+	).Decode(&updated)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link", "code": ErrCodeResetTokenInvalid})
+		return
+	}
+
+	if err := h.Revocations.RevokeAll(ctx, userID.Hex(), time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but existing sessions could not be revoked"})
+		return
+	}
+	if err := h.RefreshTokens.RevokeUser(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but existing sessions could not be revoked"})
+		return
+	}
+	// Personal access tokens go too, in case whoever had the account made some
+	if err := h.AccessTokens.RevokeUser(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but existing sessions could not be revoked"})
+		return
+	}
+
+	// A successful reset also lifts any lockout from the guessing that may
+	// have prompted it
+	if err := h.Lockout.Unlock(ctx, updated.Username); err != nil {
+		log.Printf("lockout: could not unlock %q after reset: %v", updated.Username, err)
+	}
+
+	h.clearSessionCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset; please log in with your new password"})
+}
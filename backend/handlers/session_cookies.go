@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"gotasks/middleware"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionCookies switches the auth endpoints to cookie session mode: tokens
+// are kept in HttpOnly cookies that page scripts cannot read, instead of
+// being returned for the client to store, and state-changing requests must
+// repeat the CSRF cookie in the X-CSRF-Token header.
+type SessionCookies struct {
+	// Domain is left empty to scope the cookies to the API host.
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// refreshCookiePath limits the refresh cookie to the endpoints that use it.
+const refreshCookiePath = "/api/auth"
+
+// setSessionCookies stores a new session in cookies and returns the CSRF
+// token the client must send back. A fresh CSRF token is issued with every
+// session, so one planted before login is never trusted.
+func (h *AuthHandler) setSessionCookies(c *gin.Context, token, refreshToken string) (string, error) {
+	csrf, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshTTL := h.RefreshTokens.TTL()
+	h.setCookie(c, middleware.SessionCookie, token, "/", h.Tokens.TTL(), true)
+	h.setCookie(c, middleware.RefreshCookie, refreshToken, refreshCookiePath, refreshTTL, true)
+	h.setCookie(c, middleware.CSRFCookie, csrf, "/", refreshTTL, false)
+	return csrf, nil
+}
+
+// clearSessionCookies removes the session cookies, if cookie mode is on.
+func (h *AuthHandler) clearSessionCookies(c *gin.Context) {
+	if h.Cookies == nil {
+		return
+	}
+	h.setCookie(c, middleware.SessionCookie, "", "/", -1, true)
+	h.setCookie(c, middleware.RefreshCookie, "", refreshCookiePath, -1, true)
+	h.setCookie(c, middleware.CSRFCookie, "", "/", -1, false)
+}
+
+// setCookie writes one cookie with the configured attributes. A negative
+// maxAge deletes it.
+func (h *AuthHandler) setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.Cookies.Domain,
+		Secure:   h.Cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: h.Cookies.SameSite,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gotasks/audit"
+	"gotasks/models"
+	"gotasks/sso"
+	"gotasks/store"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/oauth2"
+)
+
+// ssoStateCookie binds a single sign-on login to the browser that started
+// it, so a callback cannot be replayed into someone else's browser.
+const ssoStateCookie = "gotasks_oidc_state"
+
+// SSOLogin starts a single sign-on login by redirecting the browser to the
+// identity provider.
+func (h *AuthHandler) SSOLogin(c *gin.Context) {
+	if h.SSO == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	state, err1 := utils.NewOpaqueToken()
+	nonce, err2 := utils.NewOpaqueToken()
+	if err := errors.Join(err1, err2); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start single sign-on"})
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	authURL, err := h.SSO.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("sso: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+	if err := h.SSOLogins.SaveState(ctx, state, nonce, verifier); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start single sign-on"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, int((10 * time.Minute).Seconds()), "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback is where the identity provider sends the browser back. It
+// checks the state, redeems the code, provisions or updates the local user
+// and redirects to the frontend with a one-time code for SSOToken. Errors are
+// reported to the frontend as an "error" query parameter.
+func (h *AuthHandler) SSOCallback(c *gin.Context) {
+	if h.SSO == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	cookieState, _ := c.Cookie(ssoStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.ssoRedirect(c, url.Values{"error": {providerErr}})
+		return
+	}
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		h.ssoRedirect(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	nonce, verifier, err := h.SSOLogins.TakeState(ctx, state)
+	if err != nil {
+		h.ssoRedirect(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	identity, err := h.SSO.Exchange(ctx, c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("sso: %v", err)
+		h.ssoRedirect(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+	role, err := h.SSO.RoleFor(identity)
+	if errors.Is(err, sso.ErrNoRole) {
+		h.ssoRedirect(c, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	user, err := h.provisionSSOUser(ctx, c, identity, role)
+	if err != nil {
+		log.Printf("sso: provisioning %s/%s: %v", identity.Issuer, identity.Subject, err)
+		reason := "login_failed"
+		for _, known := range []error{errSSOUsernameInvalid, errSSOUsernameTaken} {
+			if errors.Is(err, known) {
+				reason = known.Error()
+			}
+		}
+		h.ssoRedirect(c, url.Values{"error": {reason}})
+		return
+	}
+
+	code, err := h.SSOLogins.IssueHandoff(ctx, user.ID)
+	if err != nil {
+		h.ssoRedirect(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+	h.ssoRedirect(c, url.Values{"code": {code}})
+}
+
+// SSOToken exchanges the one-time code from SSOCallback for a token pair.
+// Keeping tokens out of the redirect URL keeps them out of browser history
+// and server logs.
+func (h *AuthHandler) SSOToken(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" || h.SSO == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, err := h.SSOLogins.RedeemHandoff(ctx, body.Code)
+	if errors.Is(err, store.ErrSSOLoginInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not complete login"})
+		return
+	}
+
+	var user models.User
+	if err := h.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	if user.Disabled {
+		h.auditLogin(c, user.Username, &user, ErrCodeAccountDisabled)
+		accountDisabled(c)
+		return
+	}
+
+	refreshToken, err := h.RefreshTokens.Issue(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	h.auditLogin(c, user.Username, &user, "")
+	h.respondWithTokens(c, http.StatusOK, "Login successful", &user, refreshToken)
+}
+
+func (h *AuthHandler) ssoRedirect(c *gin.Context, params url.Values) {
+	c.Redirect(http.StatusFound, h.SSOCallbackURL+"?"+params.Encode())
+}
+
+// provisionSSOUser returns the user linked to identity, creating one on first
+// sign-in. Existing local accounts are never linked by username or email,
+// since the provider does not prove ownership of them.
+//
+// The provider's groups decide the role on every sign-in, overriding a role an
+// admin set in the meantime: group membership is managed at the provider, and
+// taking someone out of the admin group there must take effect here.
+func (h *AuthHandler) provisionSSOUser(ctx context.Context, c *gin.Context, identity *sso.Identity, role string) (*models.User, error) {
+	link := models.ExternalIdentity{Issuer: identity.Issuer, Subject: identity.Subject}
+	linked := bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": link.Issuer, "subject": link.Subject}}}
+
+	var user models.User
+	err := h.UserCollection.FindOne(ctx, linked).Decode(&user)
+	if err == nil {
+		if err := h.syncSSORole(ctx, c, &user, role); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	user = models.User{Role: role, Identities: []models.ExternalIdentity{link}}
+	if identity.EmailVerified {
+		if email, err := models.NormalizeEmail(identity.Email); err == nil {
+			user.Email = email
+		}
+	}
+
+	// Take the provider's username if it is free, otherwise add a suffix
+	base, err := ssoUsernameBase(identity)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; attempt <= maxSSOUsernameAttempts; attempt++ {
+		user.ID = primitive.NewObjectID()
+		user.Username = ssoUsernameCandidate(base, attempt)
+
+		_, err := h.UserCollection.InsertOne(ctx, user)
+		if err == nil {
+			audit.RecordRequest(c, h.Audit, audit.Event{
+				Action:     audit.Registered,
+				Actor:      audit.Actor{Username: ssoActor},
+				TargetType: audit.TargetUser,
+				TargetID:   user.ID.Hex(),
+			})
+			return &user, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		// A concurrent first sign-in of the same identity may have won the race
+		if err := h.UserCollection.FindOne(ctx, linked).Decode(&user); err == nil {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s and %s-2 to -%d", errSSOUsernameTaken, base, base, maxSSOUsernameAttempts)
+}
+
+// Reasons a first single sign-on cannot create an account, reported to the
+// frontend as the "error" query parameter.
+var (
+	errSSOUsernameInvalid = errors.New("invalid_username")
+	errSSOUsernameTaken   = errors.New("username_taken")
+)
+
+// maxSSOUsernameAttempts bounds how many suffixed usernames a first sign-in tries.
+const maxSSOUsernameAttempts = 10
+
+// syncSSORole gives user the role the provider's groups map to, if it differs.
+// Like an admin's role change, it is audited (with "sso" as the actor) and
+// signs the user out of their other sessions, whose tokens carry the old role.
+// The session being started now is issued after this, so it is kept.
+func (h *AuthHandler) syncSSORole(ctx context.Context, c *gin.Context, user *models.User, role string) error {
+	if user.Role == role {
+		return nil
+	}
+	// Matching the old role keeps a concurrent change from being audited twice
+	res, err := h.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "role": user.Role},
+		bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return h.UserCollection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(user)
+	}
+
+	audit.RecordRequest(c, h.Audit, audit.Event{
+		Action:     audit.RoleChanged,
+		Actor:      audit.Actor{Username: ssoActor},
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID.Hex(),
+		Changes:    []audit.Change{{Field: "role", Before: user.Role, After: role}},
+	})
+	user.Role = role
+
+	if err := h.Revocations.RevokeAllBefore(ctx, user.ID.Hex(), time.Now()); err != nil {
+		return err
+	}
+	return h.RefreshTokens.RevokeUser(ctx, user.ID)
+}
+
+// ssoActor is the audit actor for accounts the identity provider's claims
+// create and the changes they make.
+const ssoActor = "sso"
+
+// ssoUsernameBase picks the first of the provider's preferred username, the
+// email's local part and the subject that is a valid username, with the same
+// rules as registration (see models.NormalizeUsername).
+func ssoUsernameBase(identity *sso.Identity) (string, error) {
+	local, _, _ := strings.Cut(identity.Email, "@")
+	for _, candidate := range []string{identity.PreferredUsername, local, "sso-" + identity.Subject} {
+		if username, err := models.NormalizeUsername(candidate); err == nil {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no valid username in the claims of %s", errSSOUsernameInvalid, identity.Subject)
+}
+
+// ssoUsernameCandidate is base for the first attempt and base-<attempt> after
+// that, shortening base so the result stays within models.MaxUsernameLength.
+func ssoUsernameCandidate(base string, attempt int) string {
+	if attempt == 1 {
+		return base
+	}
+	suffix := fmt.Sprintf("-%d", attempt)
+	runes := []rune(base)
+	if keep := models.MaxUsernameLength - len(suffix); len(runes) > keep {
+		runes = runes[:keep]
+	}
+	return string(runes) + suffix
+}
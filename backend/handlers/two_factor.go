@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotasks/models"
+	"gotasks/totp"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// totpIssuer is the account label authenticator apps show.
+	totpIssuer = "GoTasks"
+	// challengeTTL is how long a user has to enter their code after the
+	// password step of a two-factor login.
+	challengeTTL = 5 * time.Minute
+)
+
+// VerifyTwoFactor completes a two-factor login: it exchanges the challenge
+// token returned by Login plus a TOTP or recovery code for a token pair.
+// Wrong codes count towards the login lockout like wrong passwords.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var body struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.ChallengeToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	claims, err := h.Tokens.ParseChallenge(body.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge; please log in again", "code": ErrCodeChallengeInvalid})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge; please log in again", "code": ErrCodeChallengeInvalid})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || !user.TwoFactorEnabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge; please log in again", "code": ErrCodeChallengeInvalid})
+		return
+	}
+
+	if !h.requireSecondFactor(ctx, c, &user, body.Code, http.StatusUnauthorized) {
+		h.auditLogin(c, user.Username, &user, ErrCodeInvalidTOTPCode)
+		return
+	}
+	// An admin may have disabled the account or required a password reset
+	// since the password was checked
+	if !h.accountUsable(c, user.Username, &user) {
+		return
+	}
+
+	refreshToken, err := h.RefreshTokens.Issue(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	h.auditLogin(c, user.Username, &user, "")
+	h.respondWithTokens(c, http.StatusOK, "Login successful", &user, refreshToken)
+}
+
+// EnrollTwoFactor starts enrollment by generating a secret to scan into an
+// authenticator app. It only becomes active once confirmed with
+// EnableTwoFactor. Re-enrolling while two-factor is on requires a current
+// code, and the old secret keeps working until the new one is confirmed.
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	_ = c.ShouldBindJSON(&body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled() && !h.requireSecondFactor(ctx, c, user, body.Code, http.StatusForbidden) {
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate secret"})
+		return
+	}
+	if _, err := h.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totp.pendingSecret": secret}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Add this secret to your authenticator app, then confirm with a code at /api/auth/2fa/enable",
+		"secret":     secret,
+		"otpauthUri": totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactor confirms a pending enrollment with a code from the new
+// secret and returns one-time recovery codes. They are shown only here;
+// only their hashes are stored.
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.TOTP == nil || user.TOTP.PendingSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "No two-factor enrollment is pending"})
+		return
+	}
+	if !h.allowCodeAttempt(ctx, c, user) {
+		return
+	}
+
+	pending := user.TOTP.PendingSecret
+	step, valid := totp.Validate(pending, strings.TrimSpace(body.Code), time.Now())
+	if !valid {
+		h.codeRejected(ctx, c, user, http.StatusForbidden)
+		return
+	}
+
+	codes, err := totp.NewRecoveryCodes(totp.RecoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate recovery codes"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+
+	// Match on the pending secret so a concurrent re-enrollment is not overwritten
+	res, err := h.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totp.pendingSecret": pending},
+		bson.M{
+			"$set": bson.M{
+				"totp.secret":        pending,
+				"totp.lastUsedStep":  step,
+				"totp.recoveryCodes": hashes,
+			},
+			"$unset": bson.M{"totp.pendingSecret": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Enrollment changed; please start again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled. Store these recovery codes somewhere safe; each works once",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor off after checking a current TOTP or
+// recovery code.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, ok := h.loadCurrentUser(ctx, c)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !h.requireSecondFactor(ctx, c, user, body.Code, http.StatusForbidden) {
+		return
+	}
+
+	if _, err := h.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"totp": ""}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// loadCurrentUser fetches the authenticated caller's user document, answering
+// 401 if it no longer exists.
+func (h *AuthHandler) loadCurrentUser(ctx context.Context, c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	var user models.User
+	err := h.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user identity"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// requireSecondFactor checks code against the user's enrollment, answering
+// with failStatus and counting a lockout failure when it is wrong. It
+// reports whether the caller may continue.
+func (h *AuthHandler) requireSecondFactor(ctx context.Context, c *gin.Context, user *models.User, code string, failStatus int) bool {
+	if !h.allowCodeAttempt(ctx, c, user) {
+		return false
+	}
+
+	valid, err := h.redeemSecondFactor(ctx, user, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify code"})
+		return false
+	}
+	if !valid {
+		h.codeRejected(ctx, c, user, failStatus)
+		return false
+	}
+
+	if err := h.Lockout.Success(ctx, user.Username); err != nil {
+		log.Printf("lockout: could not reset failures for %q: %v", user.Username, err)
+	}
+	return true
+}
+
+// allowCodeAttempt applies the login lockout to code checks, so six-digit
+// codes cannot be brute-forced.
+func (h *AuthHandler) allowCodeAttempt(ctx context.Context, c *gin.Context, user *models.User) bool {
+	decision, err := h.Lockout.Check(ctx, user.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify code"})
+		return false
+	}
+	if !decision.Allowed() {
+		tooManyAttempts(c, decision)
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandler) codeRejected(ctx context.Context, c *gin.Context, user *models.User, status int) {
+	if err := h.Lockout.Failure(ctx, user.Username, c.ClientIP()); err != nil {
+		log.Printf("lockout: could not record failure for %q: %v", user.Username, err)
+	}
+	c.JSON(status, gin.H{"error": "Invalid two-factor code", "code": ErrCodeInvalidTOTPCode})
+}
+
+// redeemSecondFactor accepts either a six-digit TOTP code or a recovery
+// code. Both are consumed atomically: a TOTP code by advancing the last used
+// time step, a recovery code by removing its hash.
+func (h *AuthHandler) redeemSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if !user.TwoFactorEnabled() {
+		return false, nil
+	}
+	code = strings.TrimSpace(code)
+
+	if isTOTPCode(code) {
+		step, valid := totp.Validate(user.TOTP.Secret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		res, err := h.UserCollection.UpdateOne(ctx,
+			bson.M{
+				"_id":         user.ID,
+				"totp.secret": user.TOTP.Secret,
+				"$or": bson.A{
+					bson.M{"totp.lastUsedStep": bson.M{"$lt": step}},
+					bson.M{"totp.lastUsedStep": bson.M{"$exists": false}},
+				},
+			},
+			bson.M{"$set": bson.M{"totp.lastUsedStep": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.MatchedCount == 1, nil
+	}
+
+	hash := utils.HashToken(totp.NormalizeRecoveryCode(code))
+	res, err := h.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totp.recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"totp.recoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
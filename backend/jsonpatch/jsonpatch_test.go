@@ -0,0 +1,124 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+// Examples from RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		target := decode(t, tt.target)
+		got := MergePatch(target, decode(t, tt.patch))
+		if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("MergePatch(%s, %s) = %v, want %v", tt.target, tt.patch, got, want)
+		}
+		if !reflect.DeepEqual(target, decode(t, tt.target)) {
+			t.Errorf("MergePatch(%s, %s) modified the target", tt.target, tt.patch)
+		}
+	}
+}
+
+// Mostly examples from RFC 6902 appendix A
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name         string
+		doc, patch   string
+		want         string
+		wantErr      bool
+		wantTestFail bool
+	}{
+		{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, want: `{"baz":"qux","foo":"bar"}`},
+		{name: "add array element", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, want: `{"foo":["bar","qux","baz"]}`},
+		{name: "append", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, want: `{"foo":["bar",["abc","def"]]}`},
+		{name: "add null", doc: `{}`, patch: `[{"op":"add","path":"/foo","value":null}]`, want: `{"foo":null}`},
+		{name: "remove member", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, want: `{"foo":"bar"}`},
+		{name: "remove element", doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, want: `{"foo":["bar","baz"]}`},
+		{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, want: `{"baz":"boo","foo":"bar"}`},
+		{name: "move member", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move element", doc: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, want: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "copy", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"}]`, want: `{"a":{"b":1},"c":{"b":1}}`},
+		{name: "test passes", doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, want: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "escaped pointer", doc: `{"/":9,"~1":10}`, patch: `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, want: `{"~1":10}`},
+		{name: "replace whole document", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":{"b":2}}]`, want: `{"b":2}`},
+		{name: "test fails", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, wantErr: true, wantTestFail: true},
+		{name: "test against string number", doc: `{"baz":"10"}`, patch: `[{"op":"test","path":"/baz","value":10}]`, wantErr: true, wantTestFail: true},
+		{name: "add to missing parent", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, wantErr: true},
+		{name: "remove missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, wantErr: true},
+		{name: "replace missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":1}]`, wantErr: true},
+		{name: "index out of range", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/2","value":1}]`, wantErr: true},
+		{name: "leading zero index", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"remove","path":"/foo/01"}]`, wantErr: true},
+		{name: "missing value", doc: `{}`, patch: `[{"op":"add","path":"/foo"}]`, wantErr: true},
+		{name: "unknown op", doc: `{}`, patch: `[{"op":"merge","path":"/foo","value":1}]`, wantErr: true},
+		{name: "move into itself", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, wantErr: true},
+		{name: "pointer without slash", doc: `{"foo":1}`, patch: `[{"op":"remove","path":"foo"}]`, wantErr: true},
+		{name: "atomic", doc: `{"foo":1}`, patch: `[{"op":"remove","path":"/foo"},{"op":"remove","path":"/foo"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := Decode([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			doc := decode(t, tt.doc)
+			got, err := Apply(doc, ops)
+
+			if !reflect.DeepEqual(doc, decode(t, tt.doc)) {
+				t.Errorf("Apply modified the document: %v", doc)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				if errors.Is(err, ErrTestFailed) != tt.wantTestFail {
+					t.Errorf("errors.Is(%v, ErrTestFailed) = %v, want %v", err, !tt.wantTestFail, tt.wantTestFail)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsNonArrays(t *testing.T) {
+	if _, err := Decode([]byte(`{"op":"add","path":"/a","value":1}`)); err == nil {
+		t.Error("expected an error for a patch that is not an array")
+	}
+}
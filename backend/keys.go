@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"strings"
+
+	"gotasks/config"
+	"gotasks/utils"
+)
+
+// newJWTManager builds the JWT signer from the auth config. Each entry of
+// cfg.Keys is kid:ALG:path, where ALG is HS256, RS256 or EdDSA and path points
+// to a PEM key (or, for HS256, a file holding the secret). Without keys,
+// cfg.Secret is used as an HS256 secret.
+//
+// To rotate, add the new key, make it the active key and drop the old entry
+// once the last token it signed has expired.
+func newJWTManager(cfg config.AuthConfig) (*utils.JWTManager, error) {
+	var keys []*utils.SigningKey
+	for _, entry := range cfg.Keys {
+		parts := strings.SplitN(entry, ":", 3)
+		key, err := utils.LoadSigningKey(utils.KeySpec{ID: parts[0], Algorithm: parts[1], File: parts[2]})
+		if err != nil {
+			return nil, fmt.Errorf("auth.keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		key, err := fallbackHMACKey(cfg.Secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	activeID := cfg.ActiveKeyID
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+
+	keySet, err := utils.NewKeySet(activeID, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewJWTManager(keySet, cfg.AccessTokenTTL.Duration), nil
+}
+
+// fallbackHMACKey uses the configured secret or, in development, a random
+// per-process secret so there is never a guessable default key.
+func fallbackHMACKey(secret string) (*utils.SigningKey, error) {
+	if secret != "" {
+		return utils.LoadSigningKey(utils.KeySpec{ID: "default", Algorithm: utils.AlgHS256, Secret: secret})
+	}
+
+	log.Println("⚠️  No JWT keys or secret configured; using a random signing key. Tokens will not survive a restart.")
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("generating fallback JWT secret: %w", err)
+	}
+	return utils.NewHMACKey("default", random)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"gotasks/config"
+	"gotasks/lockout"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newLoginGuard builds the brute-force protection for logins. The Mongo store
+// lets several instances share failure counts; the memory store is enough
+// when only one runs.
+func newLoginGuard(ctx context.Context, cfg config.LockoutConfig, db *mongo.Database) (*lockout.Guard, error) {
+	policy := lockout.DefaultPolicy()
+	policy.User.MaxFailures = cfg.MaxFailures
+	policy.IP.MaxFailures = cfg.IPMaxFailures
+	policy.LockoutDuration = cfg.Duration.Duration
+	return newGuard(ctx, cfg.Store, db.Collection("login_attempts"), policy)
+}
+
+// newResetGuard limits how often password reset links are mailed, per email
+// address and per client IP, so the endpoint cannot flood an inbox or the mail
+// relay. Every request counts as an attempt: a second one for an address waits
+// a minute and a third locks it for an hour.
+func newResetGuard(ctx context.Context, cfg config.LockoutConfig, db *mongo.Database) (*lockout.Guard, error) {
+	policy := lockout.Policy{
+		User:            lockout.Limit{FreeFailures: 1, MaxFailures: 3},
+		IP:              lockout.Limit{FreeFailures: 5, MaxFailures: 20},
+		BaseDelay:       time.Minute,
+		MaxDelay:        15 * time.Minute,
+		Window:          time.Hour,
+		LockoutDuration: time.Hour,
+	}
+	return newGuard(ctx, cfg.Store, db.Collection("reset_requests"), policy)
+}
+
+// newGuard keeps attempts in col when store is "mongo" and in memory otherwise.
+func newGuard(ctx context.Context, store string, col *mongo.Collection, policy lockout.Policy) (*lockout.Guard, error) {
+	if store != "mongo" {
+		return lockout.NewGuard(lockout.NewMemoryStore(), policy), nil
+	}
+
+	attempts := lockout.NewMongoStore(col, policy.Window+policy.LockoutDuration)
+	if err := attempts.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return lockout.NewGuard(attempts, policy), nil
+}
@@ -0,0 +1,178 @@
+// Package lockout slows down and temporarily blocks password guessing. Failed
+// logins are counted per username and per client IP; each failure beyond a
+// free allowance doubles the wait before the next attempt, and too many
+// failures lock the username or IP for a while.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Attempts is the failure history of one key.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store keeps Attempts per key. MemoryStore suits a single instance;
+// MongoStore shares state between instances.
+type Store interface {
+	// Get returns the attempts for key, or zero Attempts if there are none.
+	Get(ctx context.Context, key string) (Attempts, error)
+	// AddFailure records a failure at now. Failures older than window are
+	// forgotten first, so the returned count only covers recent ones.
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error)
+	// Lock blocks key until the given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets everything about key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Limit configures how many failures one key may accumulate.
+type Limit struct {
+	// FreeFailures may happen before any backoff applies.
+	FreeFailures int
+	// MaxFailures within the window lock the key.
+	MaxFailures int
+}
+
+// Policy configures a Guard.
+type Policy struct {
+	User      Limit
+	IP        Limit
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a failure counts against a key.
+	Window time.Duration
+	// LockoutDuration is how long a key stays locked after MaxFailures.
+	LockoutDuration time.Duration
+}
+
+// DefaultPolicy allows a couple of typos, then backs off from one second and
+// locks an account after five failures (an IP after fifty) for 15 minutes.
+func DefaultPolicy() Policy {
+	return Policy{
+		User:            Limit{FreeFailures: 2, MaxFailures: 5},
+		IP:              Limit{FreeFailures: 10, MaxFailures: 50},
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		Window:          15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+// Decision is the outcome of Guard.Check.
+type Decision struct {
+	// RetryAfter is zero when the attempt may proceed.
+	RetryAfter time.Duration
+	// Locked is true when a lockout, not just backoff, blocks the attempt.
+	Locked bool
+}
+
+// Allowed reports whether the login attempt may proceed.
+func (d Decision) Allowed() bool {
+	return d.RetryAfter <= 0
+}
+
+// Guard applies a Policy using a Store.
+type Guard struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy, now: time.Now}
+}
+
+func userKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check decides whether a login for username from ip may be attempted now.
+func (g *Guard) Check(ctx context.Context, username, ip string) (Decision, error) {
+	var decision Decision
+	now := g.now()
+
+	for _, k := range []struct {
+		key   string
+		limit Limit
+	}{{userKey(username), g.policy.User}, {ipKey(ip), g.policy.IP}} {
+		attempts, err := g.store.Get(ctx, k.key)
+		if err != nil {
+			return Decision{}, err
+		}
+
+		if wait := attempts.LockedUntil.Sub(now); wait > 0 {
+			if wait > decision.RetryAfter {
+				decision.RetryAfter = wait
+			}
+			decision.Locked = true
+			continue
+		}
+		if now.Sub(attempts.LastFailure) > g.policy.Window {
+			continue // old failures no longer count
+		}
+		if wait := attempts.LastFailure.Add(g.backoff(attempts.Failures, k.limit)).Sub(now); wait > decision.RetryAfter {
+			decision.RetryAfter = wait
+		}
+	}
+	return decision, nil
+}
+
+// Failure records a failed login and locks the username or IP once it has
+// reached its limit.
+func (g *Guard) Failure(ctx context.Context, username, ip string) error {
+	now := g.now()
+	for _, k := range []struct {
+		key   string
+		limit Limit
+	}{{userKey(username), g.policy.User}, {ipKey(ip), g.policy.IP}} {
+		attempts, err := g.store.AddFailure(ctx, k.key, now, g.policy.Window)
+		if err != nil {
+			return err
+		}
+		if k.limit.MaxFailures > 0 && attempts.Failures >= k.limit.MaxFailures {
+			if err := g.store.Lock(ctx, k.key, now.Add(g.policy.LockoutDuration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Success clears the username's failures after a successful login. The IP
+// history is kept so one valid account cannot be used to reset guessing
+// against others.
+func (g *Guard) Success(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, userKey(username))
+}
+
+// Unlock lifts a lockout on username, e.g. at an admin's request.
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, userKey(username))
+}
+
+// backoff is the wait after the given number of failures: nothing within the
+// free allowance, then BaseDelay doubling with each failure up to MaxDelay.
+func (g *Guard) backoff(failures int, limit Limit) time.Duration {
+	extra := failures - limit.FreeFailures
+	if extra <= 0 {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := 1; i < extra && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.MaxDelay {
+		delay = g.policy.MaxDelay
+	}
+	return delay
+}
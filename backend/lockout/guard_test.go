@@ -0,0 +1,153 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestGuard returns a guard on a memory store whose clock only moves when
+// the returned advance function is called.
+func newTestGuard() (*Guard, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGuard(NewMemoryStore(), Policy{
+		User:            Limit{FreeFailures: 1, MaxFailures: 4},
+		IP:              Limit{FreeFailures: 5, MaxFailures: 10},
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		Window:          10 * time.Minute,
+		LockoutDuration: 5 * time.Minute,
+	})
+	g.now = func() time.Time { return now }
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func mustCheck(t *testing.T, g *Guard, username, ip string) Decision {
+	t.Helper()
+	d, err := g.Check(context.Background(), username, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return d
+}
+
+func fail(t *testing.T, g *Guard, username, ip string, times int) {
+	t.Helper()
+	for i := 0; i < times; i++ {
+		if err := g.Failure(context.Background(), username, ip); err != nil {
+			t.Fatalf("Failure: %v", err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	g := &Guard{policy: Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}}
+	limit := Limit{FreeFailures: 2}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{40, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.backoff(tt.failures, limit); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestGuardBacksOffThenLocks(t *testing.T) {
+	g, advance := newTestGuard()
+
+	fail(t, g, "alice", "10.0.0.1", 1)
+	if d := mustCheck(t, g, "alice", "10.0.0.1"); !d.Allowed() {
+		t.Fatalf("first failure is free, got %+v", d)
+	}
+
+	fail(t, g, "alice", "10.0.0.1", 1)
+	if d := mustCheck(t, g, "alice", "10.0.0.1"); d.RetryAfter != time.Second || d.Locked {
+		t.Fatalf("after second failure got %+v, want 1s backoff", d)
+	}
+	advance(time.Second)
+	if d := mustCheck(t, g, "alice", "10.0.0.1"); !d.Allowed() {
+		t.Fatalf("backoff should have passed, got %+v", d)
+	}
+
+	fail(t, g, "alice", "10.0.0.1", 2)
+	d := mustCheck(t, g, "alice", "10.0.0.1")
+	if !d.Locked || d.RetryAfter != 5*time.Minute {
+		t.Fatalf("after max failures got %+v, want 5m lockout", d)
+	}
+
+	// The username is locked from any address, and case does not matter
+	if d := mustCheck(t, g, "ALICE", "10.0.0.2"); !d.Locked {
+		t.Errorf("lockout should follow the username, got %+v", d)
+	}
+	// Other users on the same address are not locked out
+	if d := mustCheck(t, g, "bob", "10.0.0.1"); d.Locked {
+		t.Errorf("bob should not be locked, got %+v", d)
+	}
+
+	advance(5 * time.Minute)
+	if d := mustCheck(t, g, "alice", "10.0.0.1"); d.Locked {
+		t.Errorf("lockout should have expired, got %+v", d)
+	}
+}
+
+func TestGuardLocksIP(t *testing.T) {
+	g, _ := newTestGuard()
+
+	// Spread failures across usernames so no single account locks
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		fail(t, g, name, "10.0.0.9", 1)
+	}
+
+	d := mustCheck(t, g, "newcomer", "10.0.0.9")
+	if !d.Locked {
+		t.Fatalf("address should be locked after 10 failures, got %+v", d)
+	}
+	if d := mustCheck(t, g, "newcomer", "10.0.0.10"); !d.Allowed() {
+		t.Errorf("other addresses should be unaffected, got %+v", d)
+	}
+}
+
+func TestGuardSuccessAndUnlock(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+
+	fail(t, g, "alice", "10.0.0.1", 2)
+	if err := g.Success(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if d := mustCheck(t, g, "alice", "10.0.0.3"); !d.Allowed() {
+		t.Errorf("success should clear the username's failures, got %+v", d)
+	}
+
+	fail(t, g, "alice", "10.0.0.1", 4)
+	if err := g.Unlock(ctx, "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if d := mustCheck(t, g, "alice", "10.0.0.3"); !d.Allowed() {
+		t.Errorf("unlock should lift the lockout, got %+v", d)
+	}
+}
+
+func TestGuardForgetsOldFailures(t *testing.T) {
+	g, advance := newTestGuard()
+
+	fail(t, g, "alice", "10.0.0.1", 3)
+	advance(11 * time.Minute)
+	fail(t, g, "alice", "10.0.0.1", 1)
+
+	if d := mustCheck(t, g, "alice", "10.0.0.1"); !d.Allowed() {
+		t.Errorf("failures outside the window should not count, got %+v", d)
+	}
+}
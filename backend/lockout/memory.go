@@ -0,0 +1,66 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps attempts in process memory. State is lost on restart and
+// not shared between instances; use MongoStore for multi-instance setups.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Attempts
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Attempts)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) AddFailure(_ context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.entries[key]
+	if now.Sub(a.LastFailure) > window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = now
+	s.entries[key] = a
+	s.prune(now, window)
+	return a, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.entries[key]
+	a.LockedUntil = until
+	s.entries[key] = a
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// prune drops entries that can no longer affect a decision, so the map does
+// not grow without bound. The caller holds s.mu.
+func (s *MemoryStore) prune(now time.Time, window time.Duration) {
+	for key, a := range s.entries {
+		if now.Sub(a.LastFailure) > window && now.After(a.LockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
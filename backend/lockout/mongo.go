@@ -0,0 +1,94 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps attempts in a MongoDB collection so every instance sees the
+// same counters. Documents expire through a TTL index once they can no longer
+// affect a decision.
+type MongoStore struct {
+	col *mongo.Collection
+	// retention is how long a document outlives its last change.
+	retention time.Duration
+}
+
+// NewMongoStore keeps documents for retention after their last update, which
+// must cover both the failure window and the lockout duration.
+func NewMongoStore(col *mongo.Collection, retention time.Duration) *MongoStore {
+	return &MongoStore{col: col, retention: retention}
+}
+
+type attemptsDoc struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"lastFailure"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+}
+
+func (d attemptsDoc) attempts() Attempts {
+	return Attempts{Failures: d.Failures, LastFailure: d.LastFailure, LockedUntil: d.LockedUntil}
+}
+
+// EnsureIndexes creates the TTL index that purges stale documents.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) (Attempts, error) {
+	var doc attemptsDoc
+	err := s.col.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	return doc.attempts(), nil
+}
+
+func (s *MongoStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	// A pipeline update resets and increments atomically, so concurrent
+	// failures on several instances are all counted.
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{"$lastFailure", now.Add(-window)}},
+			1,
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		}},
+		"lastFailure": now,
+		"expiresAt":   now.Add(s.retention),
+	}}}}
+
+	var doc attemptsDoc
+	err := s.col.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return Attempts{}, err
+	}
+	return doc.attempts(), nil
+}
+
+func (s *MongoStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": key},
+		bson.M{"$set": bson.M{"lockedUntil": until, "expiresAt": until.Add(s.retention)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to w instead of sending them, so reset links can
+// be picked up from the console or a file during local development.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{w: w, from: from}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	data, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := io.WriteString(m.w, "----- mail -----\r\n"); err != nil {
+		return err
+	}
+	if _, err := m.w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(m.w, "\r\n----- end mail -----\r\n")
+	return err
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf, "GoTasks <noreply@example.com>")
+
+	err := m.Send(context.Background(), Message{
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Body:    "Open this link:\nhttps://example.com/reset?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"From: GoTasks <noreply@example.com>\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: Reset your password\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nOpen this link:\r\nhttps://example.com/reset?token=abc",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := NewLogMailer(&bytes.Buffer{}, "noreply@example.com")
+
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{name: "Recipient", msg: Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"}},
+		{name: "Subject", msg: Message{To: "alice@example.com", Subject: "Hi\nBcc: eve@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Send(context.Background(), tt.msg); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("Send error = %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"gotasks/config"
+	"gotasks/mail"
+)
+
+// newMailer returns the configured mail delivery. The log driver appends to
+// cfg.File, or writes to the server log when no file is set.
+func newMailer(cfg config.MailConfig) (mail.Mailer, error) {
+	if cfg.Driver == "smtp" {
+		return mail.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	}
+
+	if cfg.File == "" {
+		return mail.NewLogMailer(log.Writer(), cfg.From), nil
+	}
+	f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return mail.NewLogMailer(f, cfg.From), nil
+}
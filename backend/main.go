@@ -2,12 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"time"
 
+	"gotasks/audit"
+	"gotasks/authz"
+	"gotasks/config"
 	"gotasks/controllers" // Add to imports
+	"gotasks/handlers"
+	"gotasks/middleware"
+	"gotasks/models"
 	"gotasks/routes"
+	"gotasks/sso"
+	"gotasks/store"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"                  // Web framework for building APIs
@@ -15,16 +27,42 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options" // MongoDB connection options
 )
 
-// Global variable to hold a reference to the MongoDB "tasks" collection
-var taskCollection *mongo.Collection
-
 func main() {
+	// =======================
+	// ⚙️ Load Configuration
+	// =======================
+
+	// Defaults < config file < environment variables < flags
+	cfg, opts, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// --print-config shows the effective settings without starting anything
+	if opts.PrintConfig {
+		if err := cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The mock identity provider is a development aid that needs no database
+	if len(opts.Args) > 0 && opts.Args[0] == "mock-idp" {
+		if err := runMockIdP(opts.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// =======================
 	// 🔌 Connect to MongoDB
 	// =======================
 
-	// Set the MongoDB URI — "mongo" is the service name (e.g., in Docker)
-	clientOptions := options.Client().ApplyURI("mongodb://mongo:27017")
+	// Set the MongoDB URI — by default "mongo", the service name in Docker
+	clientOptions := options.Client().ApplyURI(cfg.Mongo.URI)
 
 	// Create a context with a 10-second timeout for the connection
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -44,9 +82,115 @@ func main() {
 
 	fmt.Println("✅ Connected to MongoDB")
 
-	// Access the database "gotasksdb" and the collection "tasks"
-	taskCollection = client.Database("gotasksdb").Collection("tasks")
-	userCollection := client.Database("gotasks").Collection("users")
+	// Every collection lives in the single configured database
+	db := client.Database(cfg.Mongo.Database)
+	taskCollection := db.Collection("tasks")
+	userCollection := db.Collection("users")
+	refreshTokens := store.NewRefreshTokenStore(db.Collection("refresh_tokens"), cfg.Auth.RefreshTokenTTL.Duration)
+	revocations := store.NewRevocationStore(
+		db.Collection("revoked_tokens"),
+		db.Collection("token_cutoffs"),
+		cfg.Auth.AccessTokenTTL.Duration,
+	)
+	passwordResets := store.NewPasswordResetStore(db.Collection("password_resets"), cfg.Auth.PasswordResetTTL.Duration)
+	ssoLogins := store.NewSSOLoginStore(db.Collection("sso_logins"))
+	accessTokens := store.NewAccessTokenStore(db.Collection("access_tokens"), userCollection)
+	auditLog := audit.NewLog(db.Collection("audit_log"))
+
+	// Run a maintenance subcommand (e.g. "gotasks migrate status") instead of serving
+	if len(opts.Args) > 0 {
+		if err := runCommand(opts.Args[0], opts.Args[1:], cfg, db); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Bring the schema up to date before serving requests
+	if cfg.Mongo.AutoMigrate {
+		if err := migrateUp(cfg, db); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Migrations may take longer than the connection timeout allows, so the
+	// rest of the setup gets its own
+	setupCtx, setupCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer setupCancel()
+
+	// Make sure expired refresh tokens and revocations are purged and lookups stay fast
+	if err := refreshTokens.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create refresh token indexes:", err)
+	}
+	if err := revocations.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create token revocation indexes:", err)
+	}
+	if err := passwordResets.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create password reset indexes:", err)
+	}
+	if err := ssoLogins.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create single sign-on indexes:", err)
+	}
+	if err := accessTokens.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create access token indexes:", err)
+	}
+	if err := auditLog.EnsureIndexes(setupCtx); err != nil {
+		log.Fatal("Failed to create audit log indexes:", err)
+	}
+
+	// Load the keys access tokens are signed and verified with
+	tokens, err := newJWTManager(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+
+	// New passwords are hashed with the configured algorithm; older hashes are
+	// upgraded when their owners next log in
+	passwords, err := newPasswordHasher(cfg.Auth.PasswordHash)
+	if err != nil {
+		log.Fatal("Invalid password hashing settings:", err)
+	}
+
+	// New passwords must pass the configured strength and breach checks
+	passwordPolicy, err := newPasswordPolicy(cfg.Auth.PasswordPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Throttle and lock out repeated failed logins
+	loginGuard, err := newLoginGuard(setupCtx, cfg.Auth.Lockout, db)
+	if err != nil {
+		log.Fatal("Failed to set up login lockout:", err)
+	}
+	resetGuard, err := newResetGuard(setupCtx, cfg.Auth.Lockout, db)
+	if err != nil {
+		log.Fatal("Failed to set up password reset limits:", err)
+	}
+
+	// Password reset links are mailed through SMTP or, in development, logged
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to set up mail delivery:", err)
+	}
+
+	// Single sign-on is only offered when an OpenID Connect provider is configured
+	var ssoClient *sso.Client
+	if cfg.OIDC.Enabled() {
+		ssoClient = sso.NewClient(sso.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+			GroupsClaim:  cfg.OIDC.GroupsClaim,
+			AdminGroups:  cfg.OIDC.AdminGroups,
+			UserGroups:   cfg.OIDC.UserGroups,
+		})
+	}
+
+	// Create the first admin from the environment if there is none yet
+	if err := bootstrapAdmin(cfg.Admin, passwords, passwordPolicy, userCollection, auditLog); err != nil {
+		log.Fatal(err)
+	}
 
 	// ========================
 	// 🌐 Set up Gin Web Server
@@ -55,14 +199,34 @@ func main() {
 	// Initialize the default Gin router (includes logger and recovery middleware)
 	router := gin.Default()
 
-	// 💥 CORS middleware here
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// Only believe X-Forwarded-For from known proxies, so clients cannot
+	// dodge per-IP login limits by spoofing the header
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
+
+	// 💥 CORS middleware here. Browsers only send cookies cross-origin when
+	// credentials are allowed, which only cookie session mode needs
+	corsConfig := cors.Config{
+		AllowOrigins: cfg.Server.CORSOrigins,
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Authorization"},
+		MaxAge:       12 * time.Hour,
+	}
+	var sessionCookies *handlers.SessionCookies
+	if cfg.Auth.Session.CookieMode() {
+		corsConfig.AllowCredentials = true
+		corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, middleware.CSRFHeader)
+		sessionCookies = &handlers.SessionCookies{
+			Domain:   cfg.Auth.Session.CookieDomain,
+			Secure:   cfg.Auth.Session.CookieSecure,
+			SameSite: sameSiteMode(cfg.Auth.Session.CookieSameSite),
+		}
+	}
+	router.Use(cors.New(corsConfig))
+
+	// Public signing keys for services that verify our tokens
+	router.GET("/.well-known/jwks.json", handlers.JWKS(tokens))
 
 	// Health check endpoint — hit this to verify the server is running
 	router.GET("/ping", func(c *gin.Context) {
@@ -72,21 +236,73 @@ func main() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
-	// Pass collection to controller
+	// Pass collection to controller, and record every task change
 	controllers.InitController(taskCollection)
+	controllers.InitAudit(auditLog)
+
+	// Define routes — every /tasks route requires a valid JWT or a personal
+	// access token with the matching scope
+	tasks := router.Group("/tasks", middleware.AuthRequired(tokens, revocations, accessTokens))
+	readTasks := middleware.RequireScope(authz.TaskRead)
+	writeTasks := middleware.RequireScope(authz.TaskWrite)
+	tasks.GET("", readTasks, controllers.GetTasks)
+	tasks.POST("", writeTasks, controllers.AddTask)
+	tasks.PUT("/:id", writeTasks, controllers.EditTask)
+	tasks.PATCH("/:id", writeTasks, controllers.PatchTask)
+	tasks.DELETE("/:id", writeTasks, controllers.DeleteTask)
+	tasks.GET("/:id", readTasks, controllers.GetTaskDetail)
+	routes.RegisterAuthRoutes(router.Group("/api/auth"), &handlers.AuthHandler{
+		UserCollection:   userCollection,
+		TaskCollection:   taskCollection,
+		Passwords:        passwords,
+		PasswordPolicy:   passwordPolicy,
+		Tokens:           tokens,
+		RefreshTokens:    refreshTokens,
+		Revocations:      revocations,
+		Lockout:          loginGuard,
+		AccessTokens:     accessTokens,
+		PasswordResets:   passwordResets,
+		ResetRequests:    resetGuard,
+		Mailer:           mailer,
+		PasswordResetURL: cfg.Auth.PasswordResetURL,
+		SSO:              ssoClient,
+		SSOLogins:        ssoLogins,
+		SSOCallbackURL:   cfg.OIDC.FrontendCallbackURL,
+		Cookies:          sessionCookies,
+		Audit:            auditLog,
+	})
 
-	// Define routes
-	router.GET("/tasks", controllers.GetTasks)
-	router.POST("/tasks", controllers.AddTask)
-	router.PUT("/tasks/:id", controllers.EditTask)
-	router.DELETE("/tasks/:id", controllers.DeleteTask)
-	router.GET("/tasks/:id", controllers.GetTaskDetail)
-	routes.RegisterAuthRoutes(router.Group("/api/auth"), userCollection)
+	// Admin-only API; per-route permissions come from the authz policy
+	admin := router.Group("/api/admin", middleware.AuthRequired(tokens, revocations, nil), middleware.RequireRole(models.RoleAdmin))
+	routes.RegisterAdminRoutes(admin, &handlers.AdminHandler{
+		UserCollection:   userCollection,
+		TaskCollection:   taskCollection,
+		Lockout:          loginGuard,
+		RefreshTokens:    refreshTokens,
+		Revocations:      revocations,
+		AccessTokens:     accessTokens,
+		PasswordResets:   passwordResets,
+		Mailer:           mailer,
+		PasswordResetURL: cfg.Auth.PasswordResetURL,
+		Audit:            auditLog,
+	})
 
 	// ========================
 	// 🚀 Start HTTP Server
 	// ========================
 
-	// Run the server on port 8080
-	router.Run(":8080")
+	// Run the server on the configured address (":8080" by default)
+	log.Fatal(router.Run(cfg.Server.Addr))
+}
+
+// sameSiteMode maps the validated auth.session.cookieSameSite setting.
+func sameSiteMode(value string) http.SameSite {
+	switch value {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
 }
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey is the gin.Context key under which AuthRequired stores the
+// authenticated user's *utils.Claims.
+const ClaimsKey = "claims"
+
+// RevocationChecker reports whether a token has been revoked before its
+// expiry, e.g. by logging out. It is implemented by store.RevocationStore.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error)
+}
+
+// AccessTokenChecker authenticates personal access tokens, returning
+// utils.ErrInvalidToken for unknown, expired or revoked ones. It is
+// implemented by store.AccessTokenStore.
+type AccessTokenChecker interface {
+	Authenticate(ctx context.Context, token string) (*utils.Claims, error)
+}
+
+// AuthRequired rejects any request that does not carry a valid, unrevoked
+// "Authorization: Bearer <token>" header with 401 Unauthorized. The token is
+// a JWT or, when accessTokens is not nil, a personal access token. Without the
+// header, a JWT in the SessionCookie is accepted instead, provided the request
+// passes ValidCSRF. On success the token's claims are stored on the context
+// for downstream handlers.
+func AuthRequired(tokens *utils.JWTManager, revocations RevocationChecker, accessTokens AccessTokenChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := bearerToken(header)
+		fromCookie := false
+		if header == "" {
+			if cookie, err := c.Cookie(SessionCookie); err == nil && cookie != "" {
+				if !ValidCSRF(c) {
+					CSRFRejected(c)
+					return
+				}
+				token, ok, fromCookie = cookie, true, true
+			}
+		}
+		if !ok {
+			unauthorized(c, "Missing or malformed Authorization header")
+			return
+		}
+
+		// Personal access tokens are sent as headers, never as cookies
+		if utils.IsAccessToken(token) && !fromCookie {
+			authenticateAccessToken(c, accessTokens, token)
+			return
+		}
+
+		claims, err := tokens.ParseJWT(token)
+		if err != nil {
+			unauthorized(c, "Invalid or expired token")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		revoked, err := revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			return
+		}
+		if revoked {
+			unauthorized(c, "Token has been revoked")
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+func authenticateAccessToken(c *gin.Context, accessTokens AccessTokenChecker, token string) {
+	if accessTokens == nil {
+		unauthorized(c, "Personal access tokens cannot be used here")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	claims, err := accessTokens.Authenticate(ctx, token)
+	if errors.Is(err, utils.ErrInvalidToken) {
+		unauthorized(c, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+		return
+	}
+
+	c.Set(ClaimsKey, claims)
+	c.Next()
+}
+
+// CurrentUser returns the claims of the user authenticated by AuthRequired.
+// The second return value is false when the route is not protected.
+func CurrentUser(c *gin.Context) (*utils.Claims, bool) {
+	value, exists := c.Get(ClaimsKey)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*utils.Claims)
+	return claims, ok
+}
+
+// bearerToken extracts the token from an Authorization header value.
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="gotasks"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testSecret is the HS256 secret of the "test" key used by newTestTokens
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestTokens returns a JWT manager signing with testSecret under kid "test"
+func newTestTokens(t *testing.T) *utils.JWTManager {
+	key, err := utils.NewHMACKey("test", testSecret)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	keys, err := utils.NewKeySet("test", key)
+	if err != nil {
+		t.Fatalf("failed to create key set: %v", err)
+	}
+	return utils.NewJWTManager(keys, 15*time.Minute)
+}
+
+// signHS256 signs claims with secret, naming the key kid
+func signHS256(claims *utils.Claims, kid string, secret []byte) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	signed, _ := token.SignedString(secret)
+	return signed
+}
+
+// fakeRevocations treats the listed jtis as revoked
+type fakeRevocations map[string]bool
+
+func (f fakeRevocations) IsRevoked(_ context.Context, claims *utils.Claims) (bool, error) {
+	return f[claims.ID], nil
+}
+
+// fakeAccessTokens maps personal access tokens to the username they belong to
+type fakeAccessTokens map[string]string
+
+func (f fakeAccessTokens) Authenticate(_ context.Context, token string) (*utils.Claims, error) {
+	username, ok := f[token]
+	if !ok {
+		return nil, utils.ErrInvalidToken
+	}
+	return &utils.Claims{UserID: "507f1f77bcf86cd799439012", Username: username, Role: "user", Scopes: []string{}}, nil
+}
+
+// newProtectedRouter builds a router with a GET and a POST route behind
+// AuthRequired that echo the authenticated username.
+func newProtectedRouter(tokens *utils.JWTManager, revocations RevocationChecker, accessTokens AccessTokenChecker) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	echo := func(c *gin.Context) {
+		claims, ok := CurrentUser(c)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "no user on context"})
+			return
+		}
+		c.String(http.StatusOK, claims.Username)
+	}
+	router.GET("/protected", AuthRequired(tokens, revocations, accessTokens), echo)
+	router.POST("/protected", AuthRequired(tokens, revocations, accessTokens), echo)
+	return router
+}
+
+func TestAuthRequired(t *testing.T) {
+	tokens := newTestTokens(t)
+	valid, err := tokens.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	revokedToken, _ := tokens.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+	revokedClaims, _ := tokens.ParseJWT(revokedToken)
+
+	expired := signHS256(&utils.Claims{
+		UserID:   "507f1f77bcf86cd799439011",
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "expired",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}, "test", testSecret)
+
+	forged := signHS256(&utils.Claims{
+		UserID:   "507f1f77bcf86cd799439011",
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "forged",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}, "test", []byte("some-other-key-some-other-key-123"))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Valid token", header: "Bearer " + valid, wantCode: http.StatusOK, wantBody: "alice"},
+		{name: "Lowercase scheme", header: "bearer " + valid, wantCode: http.StatusOK, wantBody: "alice"},
+		{name: "Missing header", header: "", wantCode: http.StatusUnauthorized},
+		{name: "Wrong scheme", header: "Basic " + valid, wantCode: http.StatusUnauthorized},
+		{name: "Expired token", header: "Bearer " + expired, wantCode: http.StatusUnauthorized},
+		{name: "Tampered signature", header: "Bearer " + forged, wantCode: http.StatusUnauthorized},
+		{name: "Garbage token", header: "Bearer not-a-jwt", wantCode: http.StatusUnauthorized},
+		{name: "Revoked token", header: "Bearer " + revokedToken, wantCode: http.StatusUnauthorized},
+		{name: "Personal access token", header: "Bearer gtp_valid", wantCode: http.StatusOK, wantBody: "bob"},
+		{name: "Unknown personal access token", header: "Bearer gtp_unknown", wantCode: http.StatusUnauthorized},
+	}
+
+	router := newProtectedRouter(tokens, fakeRevocations{revokedClaims.ID: true}, fakeAccessTokens{"gtp_valid": "bob"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/protected", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d (%s)", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("unexpected body: got %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAuthRequiredWithoutAccessTokens(t *testing.T) {
+	router := newProtectedRouter(newTestTokens(t), fakeRevocations{}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer gtp_valid")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a personal access token on a session-only route, got %d", w.Code)
+	}
+}
+
+func TestAuthRequiredSessionCookie(t *testing.T) {
+	tokens := newTestTokens(t)
+	valid, err := tokens.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		session  string
+		csrf     string
+		header   string
+		wantCode int
+	}{
+		{name: "Read with cookie", method: "GET", session: valid, wantCode: http.StatusOK},
+		{name: "Write with cookie and CSRF token", method: "POST", session: valid, csrf: "csrf-123", header: "csrf-123", wantCode: http.StatusOK},
+		{name: "Write with cookie but no CSRF header", method: "POST", session: valid, csrf: "csrf-123", wantCode: http.StatusForbidden},
+		{name: "Write with mismatched CSRF header", method: "POST", session: valid, csrf: "csrf-123", header: "csrf-456", wantCode: http.StatusForbidden},
+		{name: "Write with header but no CSRF cookie", method: "POST", session: valid, header: "csrf-123", wantCode: http.StatusForbidden},
+		{name: "Invalid session cookie", method: "GET", session: "not-a-jwt", wantCode: http.StatusUnauthorized},
+		{name: "Access token in cookie", method: "GET", session: "gtp_valid", wantCode: http.StatusUnauthorized},
+	}
+
+	router := newProtectedRouter(tokens, fakeRevocations{}, fakeAccessTokens{"gtp_valid": "bob"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/protected", nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.session})
+			if tt.csrf != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.csrf})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d (%s)", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+
+	"gotasks/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users whose role is one of roles. It must run
+// after AuthRequired.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := CurrentUser(c)
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+		forbidden(c)
+	}
+}
+
+// RequirePermission only lets through users whose role has at least scope min
+// for action in the authz policy. With authz.ScopeOwn, ownership of the
+// individual resource is still checked by the handler. It must run after
+// AuthRequired.
+func RequirePermission(action authz.Action, min authz.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := CurrentUser(c)
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		if authz.ScopeFor(claims.Role, action) < min {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope only lets through credentials granted scope. Interactive
+// sessions have every scope; personal access tokens only those they were
+// created with. It must run after AuthRequired.
+func RequireScope(scope authz.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := CurrentUser(c)
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		if !claims.HasScope(string(scope)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token lacks the " + string(scope) + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func forbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+}
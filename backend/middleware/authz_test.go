@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotasks/authz"
+	"gotasks/models"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		role     string
+		scopes   []string
+		guard    gin.HandlerFunc
+		wantCode int
+	}{
+		{name: "Admin passes RequireRole(admin)", role: models.RoleAdmin, guard: RequireRole(models.RoleAdmin), wantCode: http.StatusOK},
+		{name: "User blocked by RequireRole(admin)", role: models.RoleUser, guard: RequireRole(models.RoleAdmin), wantCode: http.StatusForbidden},
+		{name: "User passes RequireRole(admin, user)", role: models.RoleUser, guard: RequireRole(models.RoleAdmin, models.RoleUser), wantCode: http.StatusOK},
+		{name: "User passes own-scope permission", role: models.RoleUser, guard: RequirePermission(authz.TaskWrite, authz.ScopeOwn), wantCode: http.StatusOK},
+		{name: "User blocked by any-scope permission", role: models.RoleUser, guard: RequirePermission(authz.UserRead, authz.ScopeAny), wantCode: http.StatusForbidden},
+		{name: "Admin passes any-scope permission", role: models.RoleAdmin, guard: RequirePermission(authz.UserManage, authz.ScopeAny), wantCode: http.StatusOK},
+		{name: "Session passes RequireScope", role: models.RoleUser, guard: RequireScope(authz.TaskWrite), wantCode: http.StatusOK},
+		{name: "Token with scope passes RequireScope", role: models.RoleUser, scopes: []string{string(authz.TaskRead)}, guard: RequireScope(authz.TaskRead), wantCode: http.StatusOK},
+		{name: "Token without scope blocked by RequireScope", role: models.RoleUser, scopes: []string{string(authz.TaskRead)}, guard: RequireScope(authz.TaskWrite), wantCode: http.StatusForbidden},
+		{name: "Anonymous request", role: "", guard: RequireRole(models.RoleUser), wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/guarded", func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set(ClaimsKey, &utils.Claims{UserID: "507f1f77bcf86cd799439011", Role: tt.role, Scopes: tt.scopes})
+				}
+				c.Next()
+			}, tt.guard, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/guarded", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
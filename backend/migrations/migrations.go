@@ -0,0 +1,255 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gotasks/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Legacy names the databases tasks and users lived in before everything moved
+// into one database.
+type Legacy struct {
+	TaskDatabase string
+	UserDatabase string
+}
+
+// All returns every GoTasks migration. New migrations are appended with the
+// next version number; released versions must never change.
+func All(legacy Legacy) []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "import_legacy_databases",
+			Up:      importLegacyData(legacy),
+			// The legacy databases are never modified, so there is nothing to undo
+			Down: func(context.Context, *mongo.Database) error { return nil },
+		},
+		{
+			Version: 2,
+			Name:    "users_username_unique",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createUsernameIndex(ctx, db, "username_unique", nil)
+			},
+			Down: dropIndex("users", "username_unique"),
+		},
+		{
+			Version: 3,
+			Name:    "tasks_owner_index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("tasks").Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "ownerId", Value: 1}},
+					Options: options.Index().SetName("ownerId_1"),
+				})
+				return err
+			},
+			Down: dropIndex("tasks", "ownerId_1"),
+		},
+		{
+			Version: 4,
+			Name:    "users_username_unique_case_insensitive",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := createUsernameIndex(ctx, db, "username_unique_ci", models.UsernameCollation); err != nil {
+					return err
+				}
+				return dropIndex("users", "username_unique")(ctx, db)
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				if err := createUsernameIndex(ctx, db, "username_unique", nil); err != nil {
+					return err
+				}
+				return dropIndex("users", "username_unique_ci")(ctx, db)
+			},
+		},
+		{
+			Version: 5,
+			Name:    "users_email_index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetName("email_1"),
+				})
+				return err
+			},
+			Down: dropIndex("users", "email_1"),
+		},
+		{
+			Version: 6,
+			Name:    "users_identity_unique",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys: bson.D{{Key: "identities.issuer", Value: 1}, {Key: "identities.subject", Value: 1}},
+					Options: options.Index().
+						SetName("identities_unique").
+						SetUnique(true).
+						SetPartialFilterExpression(bson.M{"identities": bson.M{"$exists": true}}),
+				})
+				return err
+			},
+			Down: dropIndex("users", "identities_unique"),
+		},
+		{
+			Version: 7,
+			Name:    "tasks_timestamps",
+			Up:      backfillTaskTimestamps,
+			// The backfilled timestamps are valid data, so only the indexes go
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				for _, name := range taskTimestampIndexes {
+					if err := dropIndex("tasks", name)(ctx, db); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// taskTimestampIndexes support listing one owner's tasks sorted by each timestamp.
+var taskTimestampIndexes = map[string]string{
+	"createdAt":   "ownerId_1_createdAt_-1",
+	"updatedAt":   "ownerId_1_updatedAt_-1",
+	"completedAt": "ownerId_1_completedAt_-1",
+}
+
+// backfillTaskTimestamps gives tasks created before timestamps existed a
+// createdAt taken from their ObjectID, which records when it was generated,
+// and the same updatedAt. When older completed tasks were finished is not
+// known, so they are left without completedAt.
+func backfillTaskTimestamps(ctx context.Context, db *mongo.Database) error {
+	tasks := db.Collection("tasks")
+
+	_, err := tasks.UpdateMany(ctx,
+		bson.M{"createdAt": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"createdAt": bson.M{"$toDate": "$_id"}}}}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tasks.UpdateMany(ctx,
+		bson.M{"updatedAt": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"updatedAt": "$createdAt"}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	for field, name := range taskTimestampIndexes {
+		_, err := tasks.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "ownerId", Value: 1}, {Key: field, Value: -1}},
+			Options: options.Index().SetName(name),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLegacyData copies tasks and users from the legacy databases into db.
+// Documents are upserted by _id, so re-running it is harmless. Sessions are
+// not copied; users simply log in again.
+func importLegacyData(legacy Legacy) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		sources := []struct{ database, collection string }{
+			{legacy.TaskDatabase, "tasks"},
+			{legacy.UserDatabase, "users"},
+		}
+		for _, src := range sources {
+			if src.database == "" || src.database == db.Name() {
+				continue
+			}
+			from := db.Client().Database(src.database).Collection(src.collection)
+			if err := copyCollection(ctx, from, db.Collection(src.collection)); err != nil {
+				return fmt.Errorf("copying %s.%s: %w", src.database, src.collection, err)
+			}
+		}
+		return nil
+	}
+}
+
+func copyCollection(ctx context.Context, from, to *mongo.Collection) error {
+	cursor, err := from.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	const batchSize = 500
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := to.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		id, ok := doc.Map()["_id"]
+		if !ok {
+			continue
+		}
+		batch = append(batch, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(doc).SetUpsert(true))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// createUsernameIndex makes usernames unique under collation (nil for exact
+// matching). Duplicates created before the index existed are reported instead
+// of failing with an opaque index error.
+func createUsernameIndex(ctx context.Context, db *mongo.Database, name string, collation *options.Collation) error {
+	users := db.Collection("users")
+
+	cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$username", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetCollation(collation))
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Username string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		names := make([]string, len(duplicates))
+		for i, d := range duplicates {
+			names[i] = d.Username
+		}
+		return fmt.Errorf("duplicate usernames must be resolved first: %s", strings.Join(names, ", "))
+	}
+
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetName(name).SetUnique(true).SetCollation(collation),
+	})
+	return err
+}
+
+func dropIndex(collection, name string) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+		return err
+	}
+}
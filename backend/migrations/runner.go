@@ -0,0 +1,246 @@
+// Package migrations applies versioned schema and data changes to the GoTasks
+// database. Applied versions are recorded in the schema_migrations collection.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one versioned step. Up must be safe to re-run if it fails
+// halfway, since the version is only recorded once Up succeeds.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// ErrLocked is returned when another process is running migrations and does
+// not finish in time.
+var ErrLocked = errors.New("migrations are already running elsewhere")
+
+// lockTimeout bounds how long a crashed runner can block others.
+const lockTimeout = 10 * time.Minute
+
+// lockRetryInterval is how often a waiting runner checks whether the lock is free.
+const lockRetryInterval = 2 * time.Second
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Runner applies and reverts migrations against one database.
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewRunner checks that versions are unique and returns a runner that applies
+// them in ascending order.
+func NewRunner(db *mongo.Database, migrations []Migration) (*Runner, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, migrations: sorted}, nil
+}
+
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			return nil, fmt.Errorf("migration %d (%s): needs a positive version and an Up step", m.Version, m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+func (r *Runner) history() *mongo.Collection {
+	return r.db.Collection("schema_migrations")
+}
+
+// Status lists every known migration and when it was applied.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			at := a.AppliedAt
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns the ones it
+// applied. It stops at the first failure.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range pending(r.migrations, applied) {
+			if err := m.Up(ctx, r.db); err != nil {
+				return fmt.Errorf("migration %d (%s) up: %w", m.Version, m.Name, err)
+			}
+			record := appliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+			if _, err := r.history().InsertOne(ctx, record); err != nil {
+				return fmt.Errorf("recording migration %d: %w", m.Version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the most recently applied migrations, up to steps of them, and
+// returns the ones it reverted.
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+			}
+			if err := m.Down(ctx, r.db); err != nil {
+				return fmt.Errorf("migration %d (%s) down: %w", m.Version, m.Name, err)
+			}
+			if _, err := r.history().DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+				return fmt.Errorf("unrecording migration %d: %w", m.Version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := r.history().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []appliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// pending returns the migrations not yet applied, in version order.
+func pending(migrations []Migration, applied map[int]appliedMigration) []Migration {
+	var out []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// withLock runs fn while holding a lock document, so several instances
+// starting at once do not apply the same migration twice. While another
+// runner holds the lock it waits for it, so fn sees whatever that runner
+// applied. A lock left behind by a crashed process expires after lockTimeout.
+func (r *Runner) withLock(ctx context.Context, fn func() error) error {
+	release, err := waitForLock(ctx, lockRetryInterval, func() (func(), error) {
+		return r.tryLock(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn()
+}
+
+// tryLock takes the lock document if it is free or expired, and returns the
+// function that releases it, or ErrLocked if another runner holds it.
+func (r *Runner) tryLock(ctx context.Context) (func(), error) {
+	locks := r.db.Collection("schema_migrations_lock")
+	owner := primitive.NewObjectID()
+	now := time.Now()
+
+	// Matches only a free or expired lock; otherwise the upsert collides on _id
+	_, err := locks.UpdateOne(ctx,
+		bson.M{"_id": "lock", "expiresAt": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(lockTimeout)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		locks.DeleteOne(context.Background(), bson.M{"_id": "lock", "owner": owner})
+	}, nil
+}
+
+// waitForLock calls try every interval for as long as it reports ErrLocked.
+// If ctx ends first the result is ErrLocked, wrapping the context's error.
+func waitForLock(ctx context.Context, interval time.Duration, try func() (func(), error)) (func(), error) {
+	logged := false
+	for {
+		release, err := try()
+		if !errors.Is(err, ErrLocked) {
+			return release, err
+		}
+		if !logged {
+			log.Printf("migrations: waiting for another runner to finish")
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", ErrLocked, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+func TestSortMigrations(t *testing.T) {
+	sorted, err := sortMigrations([]Migration{
+		{Version: 3, Name: "c", Up: noop},
+		{Version: 1, Name: "a", Up: noop},
+		{Version: 2, Name: "b", Up: noop},
+	})
+	if err != nil {
+		t.Fatalf("sortMigrations() error = %v", err)
+	}
+	for i, m := range sorted {
+		if m.Version != i+1 {
+			t.Errorf("position %d holds version %d", i, m.Version)
+		}
+	}
+
+	invalid := map[string][]Migration{
+		"Duplicate version": {{Version: 1, Up: noop}, {Version: 1, Up: noop}},
+		"Zero version":      {{Version: 0, Up: noop}},
+		"Missing Up":        {{Version: 1}},
+	}
+	for name, migrations := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := sortMigrations(migrations); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestPending(t *testing.T) {
+	all := []Migration{{Version: 1, Up: noop}, {Version: 2, Up: noop}, {Version: 3, Up: noop}}
+	applied := map[int]appliedMigration{1: {Version: 1}, 3: {Version: 3}}
+
+	got := pending(all, applied)
+	if len(got) != 1 || got[0].Version != 2 {
+		t.Errorf("expected only version 2 pending, got %+v", got)
+	}
+}
+
+func TestAllMigrationsAreValid(t *testing.T) {
+	if _, err := sortMigrations(All(Legacy{TaskDatabase: "gotasksdb", UserDatabase: "gotasks"})); err != nil {
+		t.Fatalf("built-in migrations are invalid: %v", err)
+	}
+}
+
+func TestWaitForLock(t *testing.T) {
+	// Another runner holds the lock for the first two attempts
+	attempts, released := 0, false
+	release, err := waitForLock(context.Background(), time.Millisecond, func() (func(), error) {
+		attempts++
+		if attempts <= 2 {
+			return nil, ErrLocked
+		}
+		return func() { released = true }, nil
+	})
+	if err != nil {
+		t.Fatalf("waitForLock() error = %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	release()
+	if !released {
+		t.Error("expected the returned function to release the lock")
+	}
+
+	// Other errors are not retried
+	boom := errors.New("boom")
+	attempts = 0
+	if _, err := waitForLock(context.Background(), time.Millisecond, func() (func(), error) {
+		attempts++
+		return nil, boom
+	}); !errors.Is(err, boom) || attempts != 1 {
+		t.Errorf("expected boom after one attempt, got %v after %d", err, attempts)
+	}
+
+	// A lock that is never released gives up when the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := waitForLock(ctx, time.Millisecond, func() (func(), error) {
+		return nil, ErrLocked
+	}); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"gotasks/sso/mockidp"
+)
+
+// runMockIdP serves a fake OpenID Connect provider for trying single sign-on
+// locally. It signs in the configured user without asking for credentials.
+//
+//	gotasks mock-idp [-addr :9000] [-client-id gotasks] [-client-secret dev] [-username alice] [-groups admins]
+func runMockIdP(args []string) error {
+	fs := flag.NewFlagSet("mock-idp", flag.ContinueOnError)
+	addr := fs.String("addr", ":9000", "listen address")
+	issuer := fs.String("issuer", "http://localhost:9000", "issuer URL the provider claims; must match how GoTasks reaches it")
+	clientID := fs.String("client-id", "gotasks", "accepted client ID")
+	clientSecret := fs.String("client-secret", "dev", "accepted client secret")
+	username := fs.String("username", "ssouser", "preferred_username of the signed-in user")
+	email := fs.String("email", "", "verified email of the signed-in user")
+	groups := fs.String("groups", "", "comma-separated groups of the signed-in user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	idp, err := mockidp.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		return err
+	}
+	user := mockidp.User{Subject: "mock-" + *username, PreferredUsername: *username, Email: *email, EmailVerified: *email != ""}
+	if *groups != "" {
+		user.Groups = strings.Split(*groups, ",")
+	}
+	idp.SetUser(user)
+
+	log.Printf("⚠️ Mock identity provider for %q at %s; do not use in production", *username, *issuer)
+	return http.ListenAndServe(*addr, idp)
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+
+	// Embed the time zone database so timezone validation does not depend on
+	// the host having one installed
+	_ "time/tzdata"
+)
+
+const (
+	MaxDisplayNameLength = 100
+	MaxAvatarURLLength   = 2048
+)
+
+// The Normalize* functions below check one optional profile field. Each
+// returns the canonical form of its input, and an empty input means the
+// field is cleared.
+
+// NormalizeDisplayName trims name and limits its length.
+func NormalizeDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return "", errors.New("display name must be at most 100 characters long")
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f {
+			return "", errors.New("display name must not contain control characters")
+		}
+	}
+	return name, nil
+}
+
+// NormalizeTimezone accepts an IANA time zone name such as "Europe/Berlin".
+func NormalizeTimezone(tz string) (string, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return "", nil
+	}
+	// LoadLocation also accepts "Local" and "", which mean nothing to clients
+	if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+		return "", errors.New("timezone must be an IANA time zone such as Europe/Berlin")
+	}
+	return tz, nil
+}
+
+// NormalizeLocale accepts a BCP 47 language tag such as "en-GB" and returns
+// its canonical form.
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", errors.New("locale must be a language tag such as en-GB")
+	}
+	return tag.String(), nil
+}
+
+// NormalizeAvatarURL accepts an absolute http(s) URL of the user's picture.
+func NormalizeAvatarURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > MaxAvatarURLLength {
+		return "", errors.New("avatarUrl must be an http(s) URL")
+	}
+	return raw, nil
+}
+
+// normalizeProfile applies the Normalize* functions to every profile field.
+func (u *User) normalizeProfile() error {
+	var err error
+	if u.DisplayName, err = NormalizeDisplayName(u.DisplayName); err != nil {
+		return err
+	}
+	if u.Timezone, err = NormalizeTimezone(u.Timezone); err != nil {
+		return err
+	}
+	if u.Locale, err = NormalizeLocale(u.Locale); err != nil {
+		return err
+	}
+	u.AvatarURL, err = NormalizeAvatarURL(u.AvatarURL)
+	return err
+}
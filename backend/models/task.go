@@ -2,6 +2,7 @@ package models
 
 import (
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -17,6 +18,18 @@ type Task struct {
 	Description string `json:"description"` // This field is also mapped to the JSON key "description"
 	// Completed is a boolean indicating whether the task has been completed or not
 	Completed bool `json:"completed"` // Maps to the JSON key "completed"
+	// OwnerID references the user (models.User.ID) who owns the task.
+	// It is always set by the server from the authenticated user, never by the client.
+	OwnerID primitive.ObjectID `bson:"ownerId,omitempty" json:"ownerId"`
+	// CreatedAt, UpdatedAt and CompletedAt are set by the server; whatever the client sends is ignored.
+	// They are UTC and appear in JSON as RFC 3339 times.
+	CreatedAt time.Time `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt,omitempty" json:"updatedAt"`
+	// CompletedAt is when the task was last marked completed, and null while it is open.
+	CompletedAt *time.Time `bson:"completedAt,omitempty" json:"completedAt"`
+	// Version counts the updates to the task, so PATCH can tell whether it changed since it was read.
+	// New tasks have none; every update increments it.
+	Version int64 `bson:"version,omitempty" json:"-"`
 }
 
 // Validate method checks if the Title field is not empty or just spaces
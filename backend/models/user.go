@@ -2,9 +2,13 @@ package models
 
 import (
 	"errors"
+	"net/mail"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -12,25 +16,115 @@ const (
 	RoleUser  = "user"
 )
 
+// UsernameCollation compares usernames case-insensitively, so "Alice" and
+// "alice" are the same account. Every query on username must use it for the
+// unique index to apply.
+var UsernameCollation = &options.Collation{Locale: "en", Strength: 2}
+
 type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Username string             `bson:"username" json:"username"`
 	Password string             `bson:"password" json:"password,omitempty"`
 	Role     string             `bson:"role" json:"role"` // "admin" or "user"
+	// Email is optional; without it the account cannot reset its password.
+	Email string `bson:"email,omitempty" json:"email,omitempty"`
+	// Optional profile fields, edited through /api/auth/me; see profile.go.
+	DisplayName string `bson:"displayName,omitempty" json:"displayName,omitempty"`
+	Timezone    string `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Locale      string `bson:"locale,omitempty" json:"locale,omitempty"`
+	AvatarURL   string `bson:"avatarUrl,omitempty" json:"avatarUrl,omitempty"`
+	// Disabled accounts cannot log in and their tokens are rejected.
+	Disabled bool `bson:"disabled,omitempty" json:"disabled,omitempty"`
+	// PasswordResetRequired is set by an admin; logging in with the password
+	// is refused until it is changed through a reset link.
+	PasswordResetRequired bool `bson:"passwordResetRequired,omitempty" json:"passwordResetRequired,omitempty"`
+	// TOTP holds two-factor settings; it is never sent to clients.
+	TOTP *TOTPSettings `bson:"totp,omitempty" json:"-"`
+	// Identities link the account to single sign-on providers. Such accounts
+	// may have no password.
+	Identities []ExternalIdentity `bson:"identities,omitempty" json:"-"`
+}
+
+// ExternalIdentity is an account at an OpenID Connect provider, identified by
+// the provider's issuer URL and its stable subject ID for the user.
+type ExternalIdentity struct {
+	Issuer  string `bson:"issuer"`
+	Subject string `bson:"subject"`
+}
+
+// TOTPSettings is a user's authenticator-app enrollment.
+type TOTPSettings struct {
+	// Secret is the confirmed base32 secret; empty until enrollment is confirmed.
+	Secret string `bson:"secret,omitempty"`
+	// PendingSecret awaits confirmation with a first code. Re-enrolling keeps
+	// the old Secret working until then.
+	PendingSecret string `bson:"pendingSecret,omitempty"`
+	// LastUsedStep is the time step of the last accepted code, so a code
+	// cannot be replayed.
+	LastUsedStep int64 `bson:"lastUsedStep,omitempty"`
+	// RecoveryCodes are hashes of the unused recovery codes.
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty"`
+}
+
+// TwoFactorEnabled reports whether logging in needs a TOTP or recovery code.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTP != nil && u.TOTP.Secret != ""
 }
 
 func (u *User) Validate() error {
-	u.Username = strings.TrimSpace(u.Username)
+	username, err := NormalizeUsername(u.Username)
+	if err != nil {
+		return err
+	}
+	u.Username = username
 	u.Role = strings.ToLower(strings.TrimSpace(u.Role))
 
-	if u.Username == "" {
-		return errors.New("username cannot be empty")
-	}
-	if len(u.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
+	// Strength rules are configurable and live in package passpolicy
+	if u.Password == "" {
+		return errors.New("password cannot be empty")
 	}
 	if u.Role != RoleAdmin && u.Role != RoleUser {
 		return errors.New("role must be either 'admin' or 'user'")
 	}
-	return nil
+	if u.Email != "" {
+		email, err := NormalizeEmail(u.Email)
+		if err != nil {
+			return err
+		}
+		u.Email = email
+	}
+	return u.normalizeProfile()
+}
+
+// MaxUsernameLength is the longest username, in characters.
+const MaxUsernameLength = 64
+
+// NormalizeUsername trims a new username and checks it is 1 to
+// MaxUsernameLength letters, digits and the punctuation . _ - @ +.
+// Uniqueness is case-insensitive; see UsernameCollation.
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", errors.New("username cannot be empty")
+	}
+	if utf8.RuneCountInString(username) > MaxUsernameLength {
+		return "", errors.New("username must be at most 64 characters long")
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-@+", r) {
+			return "", errors.New("username may only contain letters, digits and . _ - @ +")
+		}
+	}
+	return username, nil
+}
+
+// NormalizeEmail trims and lower-cases a bare address such as
+// "alice@example.com", rejecting anything else, including display names.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("email must be a valid address")
+	}
+	return email, nil
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"testing"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -35,15 +36,15 @@ func TestUserValidate(t *testing.T) {
 			errMsg:  "username cannot be empty",
 		},
 		{
-			name: "Short password",
+			name: "Empty password",
 			user: User{
 				ID:       primitive.NewObjectID(),
 				Username: "JohnDoe",
-				Password: "123",
+				Password: "",
 				Role:     RoleUser,
 			},
 			wantErr: true,
-			errMsg:  "password must be at least 6 characters long",
+			errMsg:  "password cannot be empty",
 		},
 		{
 			name: "Invalid role",
@@ -56,6 +57,27 @@ func TestUserValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "role must be either 'admin' or 'user'",
 		},
+		{
+			name: "Valid email",
+			user: User{
+				Username: "JohnDoe",
+				Password: "password123",
+				Role:     RoleUser,
+				Email:    " John@Example.com ",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid email",
+			user: User{
+				Username: "JohnDoe",
+				Password: "password123",
+				Role:     RoleUser,
+				Email:    "John Doe <john@example.com>",
+			},
+			wantErr: true,
+			errMsg:  "email must be a valid address",
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,3 +92,91 @@ func TestUserValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: " alice ", want: "alice"},
+		{in: "jane.doe+work@example.com", want: "jane.doe+work@example.com"},
+		{in: "José_Müller-2", want: "José_Müller-2"},
+		{in: strings.Repeat("x", MaxUsernameLength), want: strings.Repeat("x", MaxUsernameLength)},
+		{in: "", wantErr: true},
+		{in: strings.Repeat("x", MaxUsernameLength+1), wantErr: true},
+		{in: "John Doe", wantErr: true},
+		{in: "alice/../bob", wantErr: true},
+		{in: "alice\x00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeUsername(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeUsername(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeUsername(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "alice@example.com", want: "alice@example.com"},
+		{in: "  Alice@Example.COM ", want: "alice@example.com"},
+		{in: "alice", wantErr: true},
+		{in: "alice@example.com\r\nBcc: eve@example.com", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeEmail(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeProfileFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize func(string) (string, error)
+		in        string
+		want      string
+		wantErr   bool
+	}{
+		{name: "Display name", normalize: NormalizeDisplayName, in: "  Jane Doe ", want: "Jane Doe"},
+		{name: "Display name too long", normalize: NormalizeDisplayName, in: strings.Repeat("x", MaxDisplayNameLength+1), wantErr: true},
+		{name: "Display name with newline", normalize: NormalizeDisplayName, in: "Jane\nDoe", wantErr: true},
+		{name: "Timezone", normalize: NormalizeTimezone, in: "Europe/Berlin", want: "Europe/Berlin"},
+		{name: "Cleared timezone", normalize: NormalizeTimezone, in: " ", want: ""},
+		{name: "Unknown timezone", normalize: NormalizeTimezone, in: "Mars/Olympus", wantErr: true},
+		{name: "Local timezone", normalize: NormalizeTimezone, in: "Local", wantErr: true},
+		{name: "Locale", normalize: NormalizeLocale, in: "en-gb", want: "en-GB"},
+		{name: "Invalid locale", normalize: NormalizeLocale, in: "not a locale", wantErr: true},
+		{name: "Avatar URL", normalize: NormalizeAvatarURL, in: "https://example.com/me.png", want: "https://example.com/me.png"},
+		{name: "Script avatar URL", normalize: NormalizeAvatarURL, in: "javascript:alert(1)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.normalize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Package passhash hashes and verifies user passwords. New hashes use argon2id
+// or bcrypt as configured; stored hashes of either kind keep working, and
+// Verify reports when one should be replaced because it was made with another
+// algorithm or other parameters.
+//
+// Argon2id hashes are PHC strings such as
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>; bcrypt hashes keep their usual
+// $2a$<cost>$... form.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms new hashes can be made with.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+// ErrUnknownFormat is returned by Verify for hashes it cannot parse.
+var ErrUnknownFormat = errors.New("passhash: unknown hash format")
+
+var encoding = base64.RawStdEncoding
+
+// Params choose the algorithm and cost of new hashes.
+type Params struct {
+	// Algorithm is Argon2id or Bcrypt.
+	Algorithm string
+	// Memory (in KiB), Time (passes) and Parallelism (lanes) tune argon2id.
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	// BcryptCost is the bcrypt work factor.
+	BcryptCost int
+}
+
+// DefaultParams returns argon2id with 64 MiB, 3 passes and 2 lanes, and a
+// bcrypt cost of 12 for deployments that select bcrypt.
+func DefaultParams() Params {
+	return Params{
+		Algorithm:   Argon2id,
+		Memory:      64 * 1024,
+		Time:        3,
+		Parallelism: 2,
+		BcryptCost:  12,
+	}
+}
+
+// Hasher hashes passwords with one set of Params.
+type Hasher struct {
+	params Params
+	// decoy is a hash of decoyPassword made with params, for VerifyDecoy.
+	decoy string
+}
+
+// decoyPassword is what the decoy hash hashes. It is never compared with a
+// stored hash, so it need not be secret.
+const decoyPassword = "passhash decoy"
+
+// NewHasher checks params and returns a Hasher using them.
+func NewHasher(params Params) (*Hasher, error) {
+	switch params.Algorithm {
+	case Argon2id:
+		if params.Time < 1 || params.Parallelism < 1 {
+			return nil, errors.New("passhash: argon2id time and parallelism must be at least 1")
+		}
+		if params.Memory < 8*uint32(params.Parallelism) {
+			return nil, errors.New("passhash: argon2id memory must be at least 8 KiB per lane")
+		}
+	case Bcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("passhash: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("passhash: unknown algorithm %q", params.Algorithm)
+	}
+	h := &Hasher{params: params}
+	decoy, err := h.Hash(decoyPassword)
+	if err != nil {
+		return nil, err
+	}
+	h.decoy = decoy
+	return h, nil
+}
+
+// Hash returns a new encoded hash of password.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Bcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		return string(hashed), err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := argon2Params{memory: h.params.Memory, time: h.params.Time, parallelism: h.params.Parallelism}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.parallelism, keyLength)
+	return p.encode(salt, key), nil
+}
+
+// Verify reports whether password matches encoded and, if it does, whether
+// encoded should be replaced by a fresh Hash because it does not use the
+// current algorithm and parameters. A mismatch is not an error.
+func (h *Hasher) Verify(password, encoded string) (match, rehash bool, err error) {
+	if strings.HasPrefix(encoded, "$"+Argon2id+"$") {
+		p, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+		current := argon2Params{memory: h.params.Memory, time: h.params.Time, parallelism: h.params.Parallelism}
+		return true, h.params.Algorithm != Argon2id || p != current || len(salt) != saltLength || len(key) != keyLength, nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, ErrUnknownFormat
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, h.params.Algorithm != Bcrypt || cost != h.params.BcryptCost, nil
+}
+
+// VerifyDecoy takes as long as Verify does on a hash made with the current
+// params, and never matches. Call it when there is no stored hash to check,
+// such as at login with an unknown username, so the response time does not
+// reveal that.
+func (h *Hasher) VerifyDecoy(password string) {
+	h.Verify(password, h.decoy)
+}
+
+type argon2Params struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+}
+
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		p.memory, p.time, p.parallelism, encoding.EncodeToString(salt), encoding.EncodeToString(key))
+}
+
+// decodeArgon2 parses an argon2id PHC string.
+func decodeArgon2(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("passhash: unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.parallelism); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if p.time < 1 || p.parallelism < 1 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	return p, salt, key, nil
+}
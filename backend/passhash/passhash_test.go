@@ -0,0 +1,126 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2 keeps the tests quick; real deployments use DefaultParams.
+var fastArgon2 = Params{Algorithm: Argon2id, Memory: 64, Time: 1, Parallelism: 1, BcryptCost: bcrypt.MinCost}
+
+func mustHasher(t *testing.T, params Params) *Hasher {
+	t.Helper()
+	h, err := NewHasher(params)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := mustHasher(t, fastArgon2)
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected PHC string %q", encoded)
+	}
+
+	match, rehash, err := h.Verify("correct horse", encoded)
+	if err != nil || !match || rehash {
+		t.Errorf("Verify(right password) = %v, %v, %v; want match without rehash", match, rehash, err)
+	}
+	match, _, err = h.Verify("wrong horse", encoded)
+	if err != nil || match {
+		t.Errorf("Verify(wrong password) = %v, %v; want no match", match, err)
+	}
+
+	other, _ := h.Hash("correct horse")
+	if other == encoded {
+		t.Error("two hashes of the same password should use different salts")
+	}
+}
+
+func TestVerifyRequestsRehash(t *testing.T) {
+	bcryptHasher := mustHasher(t, Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakArgon2, _ := mustHasher(t, fastArgon2).Hash("secret")
+
+	stronger := fastArgon2
+	stronger.Time = 2
+
+	tests := []struct {
+		name       string
+		hasher     *Hasher
+		encoded    string
+		wantRehash bool
+	}{
+		{name: "bcrypt hash under argon2id", hasher: mustHasher(t, fastArgon2), encoded: string(legacy), wantRehash: true},
+		{name: "bcrypt hash with current cost", hasher: bcryptHasher, encoded: string(legacy), wantRehash: false},
+		{name: "bcrypt hash with other cost", hasher: mustHasher(t, Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}), encoded: string(legacy), wantRehash: true},
+		{name: "argon2id hash with current params", hasher: mustHasher(t, fastArgon2), encoded: weakArgon2, wantRehash: false},
+		{name: "argon2id hash with old params", hasher: mustHasher(t, stronger), encoded: weakArgon2, wantRehash: true},
+		{name: "argon2id hash under bcrypt", hasher: bcryptHasher, encoded: weakArgon2, wantRehash: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := tt.hasher.Verify("secret", tt.encoded)
+			if err != nil || !match {
+				t.Fatalf("Verify = %v, %v; want a match", match, err)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("rehash = %v, want %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	h := mustHasher(t, fastArgon2)
+	for _, encoded := range []string{
+		"",
+		"plain-text",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=19$m=64,t=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+	} {
+		if match, _, err := h.Verify("secret", encoded); match || err == nil {
+			t.Errorf("Verify(%q) = %v, %v; want an error", encoded, match, err)
+		}
+	}
+}
+
+func TestNewHasherValidatesParams(t *testing.T) {
+	for _, params := range []Params{
+		{Algorithm: "md5"},
+		{Algorithm: Argon2id, Memory: 64, Time: 0, Parallelism: 1},
+		{Algorithm: Argon2id, Memory: 4, Time: 1, Parallelism: 1},
+		{Algorithm: Bcrypt, BcryptCost: 2},
+	} {
+		if _, err := NewHasher(params); err == nil {
+			t.Errorf("NewHasher(%+v) should fail", params)
+		}
+	}
+	if _, err := NewHasher(DefaultParams()); err != nil {
+		t.Errorf("DefaultParams should be valid: %v", err)
+	}
+}
+
+func TestDecoyUsesCurrentParams(t *testing.T) {
+	for _, params := range []Params{fastArgon2, {Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}} {
+		h := mustHasher(t, params)
+		// A decoy with other params would take a different time than a real hash
+		match, rehash, err := h.Verify(decoyPassword, h.decoy)
+		if err != nil || !match || rehash {
+			t.Errorf("%s decoy: Verify = %v, %v, %v; want match without rehash", params.Algorithm, match, rehash, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package passpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixLength is how many hex digits of the SHA-1 hash select a bucket,
+// as in the Have I Been Pwned range API.
+const prefixLength = 5
+
+// BreachedList holds the SHA-1 hashes of passwords known from data breaches,
+// bucketed by the first five hex digits of the hash the way k-anonymity
+// range queries are. A lookup only searches the password's bucket.
+type BreachedList struct {
+	buckets map[string][]string
+	size    int
+}
+
+// LoadBreachedList reads a breached-password hash file; see ReadBreachedList.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list, err := ReadBreachedList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
+
+// ReadBreachedList parses one upper- or lower-case hex SHA-1 hash per line,
+// optionally followed by ":count" as in the Pwned Passwords downloads. Blank
+// lines and lines starting with # are skipped.
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{buckets: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(entry, ":")
+		hash = strings.ToUpper(strings.TrimSpace(hash))
+		if len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		prefix := hash[:prefixLength]
+		list.buckets[prefix] = append(list.buckets[prefix], hash[prefixLength:])
+		list.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.buckets {
+		sort.Strings(suffixes)
+	}
+	return list, nil
+}
+
+// Len returns the number of hashes in the list.
+func (l *BreachedList) Len() int {
+	return l.size
+}
+
+// Contains reports whether password is in the list.
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := l.buckets[hash[:prefixLength]]
+	i := sort.SearchStrings(suffixes, hash[prefixLength:])
+	return i < len(suffixes) && suffixes[i] == hash[prefixLength:]
+}
@@ -0,0 +1,131 @@
+// Package passpolicy decides whether a new password is strong enough: long
+// enough, hard enough to guess, not built from the username and not known
+// from a data breach.
+package passpolicy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules a password can break, reported in Violation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleEntropy   = "entropy"
+	RuleUsername  = "contains_username"
+	RuleBreached  = "breached"
+)
+
+// Violation is one rule a password breaks.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists every rule a password breaks.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Policy is the set of rules new passwords must follow.
+type Policy struct {
+	// MinLength is counted in characters, not bytes.
+	MinLength int
+	// MinEntropy is the minimum Entropy score in bits.
+	MinEntropy float64
+	// RejectUsername refuses passwords containing the username.
+	RejectUsername bool
+	// Breached, when set, refuses passwords found in it.
+	Breached *BreachedList
+}
+
+// DefaultPolicy requires eight characters and 40 bits of entropy and refuses
+// the username. It has no breached-password list.
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8, MinEntropy: 40, RejectUsername: true}
+}
+
+// Check returns an *Error listing every rule password breaks, or nil.
+func (p *Policy) Check(password, username string) error {
+	var violations []Violation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{RuleMinLength, "password must be at least " + strconv.Itoa(p.MinLength) + " characters long"})
+	}
+	if Entropy(password) < p.MinEntropy {
+		violations = append(violations, Violation{RuleEntropy, "password is too easy to guess; use more varied characters or a longer passphrase"})
+	}
+	if p.RejectUsername && containsUsername(password, username) {
+		violations = append(violations, Violation{RuleUsername, "password must not contain the username"})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{RuleBreached, "password appears in a known data breach; choose another"})
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// Entropy estimates the bits of entropy of password from the character
+// classes it draws on. Repeated characters count half, so "aaaaaaaa" or
+// "abcabcabc" score far lower than their length suggests.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	seen := make(map[rune]bool)
+	distinct, repeated := 0, 0
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if seen[r] {
+			repeated++
+		} else {
+			seen[r] = true
+			distinct++
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return math.Log2(float64(pool)) * (float64(distinct) + float64(repeated)/2)
+}
+
+// containsUsername ignores case and usernames too short to matter.
+func containsUsername(password, username string) bool {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if utf8.RuneCountInString(username) < 3 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(password), username)
+}
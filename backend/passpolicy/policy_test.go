@@ -0,0 +1,85 @@
+package passpolicy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// SHA-1 of "password" and "Tr0ub4dour&3"
+const breachedFile = `# Pwned Passwords sample
+5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824
+9f206fa9619ecb33a6f1d80ff54995760f6663d0
+`
+
+func TestCheck(t *testing.T) {
+	breached, err := ReadBreachedList(strings.NewReader(breachedFile))
+	if err != nil {
+		t.Fatalf("ReadBreachedList: %v", err)
+	}
+	policy := &Policy{MinLength: 8, MinEntropy: 40, RejectUsername: true, Breached: breached}
+
+	tests := []struct {
+		name      string
+		password  string
+		username  string
+		wantRules []string
+	}{
+		{name: "Strong passphrase", password: "correct horse battery staple", username: "alice"},
+		{name: "Mixed classes", password: "Gq7#pLm2", username: "alice"},
+		{name: "Too short", password: "Gq7#p", username: "alice", wantRules: []string{RuleMinLength, RuleEntropy}},
+		{name: "Repeated characters", password: "aaaaaaaaaaaa", username: "alice", wantRules: []string{RuleEntropy}},
+		{name: "Contains username", password: "xx-ALICE-2024!", username: "alice", wantRules: []string{RuleUsername}},
+		{name: "Short usernames are ignored", password: "Gq7#pLm2al", username: "al"},
+		{name: "Breached", password: "password", username: "alice", wantRules: []string{RuleEntropy, RuleBreached}},
+		{name: "Breached but complex", password: "Tr0ub4dour&3", username: "alice", wantRules: []string{RuleBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.username)
+			if len(tt.wantRules) == 0 {
+				if err != nil {
+					t.Fatalf("Check = %v, want nil", err)
+				}
+				return
+			}
+
+			var policyErr *Error
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check = %v, want *Error", err)
+			}
+			var rules []string
+			for _, v := range policyErr.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("violated rules = %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if e := Entropy(""); e != 0 {
+		t.Errorf("Entropy(\"\") = %v, want 0", e)
+	}
+	if Entropy("abcabcabcabc") >= Entropy("abcdefghijkl") {
+		t.Error("repeating a pattern should score lower than distinct characters")
+	}
+	if Entropy("abcdefgh") >= Entropy("aBcD3f#h") {
+		t.Error("mixing character classes should score higher")
+	}
+}
+
+func TestReadBreachedListRejectsGarbage(t *testing.T) {
+	if _, err := ReadBreachedList(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+	list, err := ReadBreachedList(strings.NewReader(breachedFile))
+	if err != nil || list.Len() != 2 {
+		t.Fatalf("ReadBreachedList = %v entries, %v; want 2", list.Len(), err)
+	}
+	if list.Contains("Password") {
+		t.Error("lookups must be exact")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"gotasks/config"
+	"gotasks/passhash"
+	"gotasks/passpolicy"
+)
+
+// newPasswordHasher returns the hasher new and upgraded passwords are stored with.
+func newPasswordHasher(cfg config.PasswordHashConfig) (*passhash.Hasher, error) {
+	return passhash.NewHasher(passhash.Params{
+		Algorithm:   cfg.Algorithm,
+		Memory:      uint32(cfg.Argon2Memory),
+		Time:        uint32(cfg.Argon2Time),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+		BcryptCost:  cfg.BcryptCost,
+	})
+}
+
+// newPasswordPolicy returns the rules new passwords are checked against,
+// loading the breached-password list when one is configured.
+func newPasswordPolicy(cfg config.PasswordPolicyConfig) (*passpolicy.Policy, error) {
+	policy := &passpolicy.Policy{
+		MinLength:      cfg.MinLength,
+		MinEntropy:     float64(cfg.MinEntropy),
+		RejectUsername: cfg.RejectUsername,
+	}
+	if cfg.BreachedList != "" {
+		breached, err := passpolicy.LoadBreachedList(cfg.BreachedList)
+		if err != nil {
+			return nil, fmt.Errorf("loading breached passwords: %w", err)
+		}
+		fmt.Printf("✅ Loaded %d breached password hashes\n", breached.Len())
+		policy.Breached = breached
+	}
+	return policy, nil
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"gotasks/authz"
+	"gotasks/handlers"
+	"gotasks/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes mounts the user-management API. The group passed in must
+// already require an authenticated admin.
+func RegisterAdminRoutes(rg *gin.RouterGroup, h *handlers.AdminHandler) {
+	read := middleware.RequirePermission(authz.UserRead, authz.ScopeAny)
+	manage := middleware.RequirePermission(authz.UserManage, authz.ScopeAny)
+
+	rg.GET("/users", read, h.ListUsers)
+	rg.GET("/users/:id", read, h.GetUser)
+	rg.PATCH("/users/:id/role", manage, h.SetRole)
+	rg.POST("/users/:id/unlock", manage, h.Unlock)
+	rg.POST("/users/:id/disable", manage, h.Disable)
+	rg.POST("/users/:id/enable", manage, h.Enable)
+	rg.POST("/users/:id/password-reset", manage, h.ForcePasswordReset)
+	rg.DELETE("/users/:id", manage, h.DeleteUser)
+
+	auditRead := middleware.RequirePermission(authz.AuditRead, authz.ScopeAny)
+	rg.GET("/audit", auditRead, h.ListAuditEvents)
+	rg.GET("/audit/export", auditRead, h.ExportAuditEvents)
+}
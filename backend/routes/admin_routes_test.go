@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotasks/audit"
+	"gotasks/handlers"
+	"gotasks/middleware"
+	"gotasks/models"
+	"gotasks/store"
+	"gotasks/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Test that demoting an admin revokes the admin tokens they already hold.
+// The database is the driver's mock deployment, which answers commands with
+// queued responses in order.
+func TestSetRoleRevokesOldAdminTokens(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("demote", func(mt *mtest.T) {
+		gin.SetMode(gin.TestMode)
+		key, err := utils.NewHMACKey("test", []byte("0123456789abcdef0123456789abcdef"))
+		if err != nil {
+			mt.Fatalf("failed to create key: %v", err)
+		}
+		keys, err := utils.NewKeySet("test", key)
+		if err != nil {
+			mt.Fatalf("failed to create key set: %v", err)
+		}
+		tokens := utils.NewJWTManager(keys, 15*time.Minute)
+
+		db := mt.DB
+		revocations := store.NewRevocationStore(db.Collection("revoked_tokens"), db.Collection("token_cutoffs"), 15*time.Minute)
+		router := gin.New()
+		admin := router.Group("/api/admin", middleware.AuthRequired(tokens, revocations, nil), middleware.RequireRole(models.RoleAdmin))
+		RegisterAdminRoutes(admin, &handlers.AdminHandler{
+			UserCollection: db.Collection("users"),
+			Revocations:    revocations,
+			RefreshTokens:  store.NewRefreshTokenStore(db.Collection("refresh_tokens"), time.Hour),
+			Audit:          audit.NewLog(db.Collection("audit_log")),
+		})
+
+		callerID, demotedID := primitive.NewObjectID(), primitive.NewObjectID()
+		callerToken, _ := tokens.GenerateJWT(callerID.Hex(), "alice", models.RoleAdmin)
+		oldToken, _ := tokens.GenerateJWT(demotedID.Hex(), "bob", models.RoleAdmin)
+
+		empty := func(col string) bson.D { return mtest.CreateCursorResponse(0, "db."+col, mtest.FirstBatch) }
+		mt.AddMockResponses(
+			// alice's token is not revoked
+			empty("revoked_tokens"),
+			empty("token_cutoffs"),
+			// SetRole loads bob, updates the account and counts the admins left
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: demotedID}, {Key: "username", Value: "bob"}, {Key: "role", Value: models.RoleAdmin}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			// audit event, token cut-off and refresh token revocation
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/admin/users/"+demotedID.Hex()+"/role", strings.NewReader(`{"role": "user"}`))
+		req.Header.Set("Authorization", "Bearer "+callerToken)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			mt.Fatalf("expected 200 OK demoting bob, got %d: %s", w.Code, w.Body.String())
+		}
+
+		// Find the cut-off SetRole stored for bob
+		var cutoff bson.RawValue
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName != "update" || e.Command.Lookup("update").StringValue() != "token_cutoffs" {
+				continue
+			}
+			update, _ := e.Command.Lookup("updates").Array().Index(0).Value().Document().LookupErr("u", "$max", "notBefore")
+			cutoff = update
+		}
+		if cutoff.Type == 0 {
+			mt.Fatal("expected demoting bob to revoke their tokens")
+		}
+
+		// The database now holds that cut-off, so bob's old admin token is rejected
+		mt.AddMockResponses(
+			empty("revoked_tokens"),
+			mtest.CreateCursorResponse(0, "db.token_cutoffs", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: demotedID.Hex()}, {Key: "notBefore", Value: cutoff}}),
+		)
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/admin/users", nil)
+		req.Header.Set("Authorization", "Bearer "+oldToken)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized && w.Code != http.StatusForbidden {
+			mt.Fatalf("expected bob's old admin token to be rejected, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// Test that a demotion leaving no enabled admin, as when another admin was
+// demoted at the same time, is undone and refused.
+func TestSetRoleKeepsLastAdmin(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("demote", func(mt *mtest.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(middleware.ClaimsKey, &utils.Claims{UserID: primitive.NewObjectID().Hex(), Username: "alice", Role: models.RoleAdmin})
+		})
+		RegisterAdminRoutes(router.Group("/api/admin"), &handlers.AdminHandler{
+			UserCollection: mt.DB.Collection("users"),
+			Audit:          audit.NewLog(mt.DB.Collection("audit_log")),
+		})
+
+		demotedID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			// SetRole loads bob and demotes the account, finds no admin left and promotes it again
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: demotedID}, {Key: "username", Value: "bob"}, {Key: "role", Value: models.RoleAdmin}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{{Key: "n", Value: 0}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/admin/users/"+demotedID.Hex()+"/role", strings.NewReader(`{"role": "user"}`))
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusConflict {
+			mt.Fatalf("expected 409 Conflict demoting the last admin, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var roles []string
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "update" {
+				role, _ := e.Command.Lookup("updates").Array().Index(0).Value().Document().LookupErr("u", "$set", "role")
+				roles = append(roles, role.StringValue())
+			}
+		}
+		if len(roles) != 2 || roles[0] != models.RoleUser || roles[1] != models.RoleAdmin {
+			mt.Fatalf("expected the demotion to be undone, got role updates %v", roles)
+		}
+	})
+}
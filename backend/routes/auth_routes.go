@@ -2,14 +2,44 @@ package routes
 
 import (
 	"gotasks/handlers"
+	"gotasks/middleware"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterAuthRoutes(rg *gin.RouterGroup, userCollection *mongo.Collection) {
-	h := handlers.NewAuthHandler(userCollection)
+func RegisterAuthRoutes(rg *gin.RouterGroup, h *handlers.AuthHandler) {
+	// Account endpoints need an interactive session; personal access tokens
+	// are not accepted here
+	authRequired := middleware.AuthRequired(h.Tokens, h.Revocations, nil)
 
 	rg.POST("/register", h.Register)
+	rg.GET("/username-available", h.UsernameAvailable)
 	rg.POST("/login", h.Login)
+	rg.POST("/refresh", h.Refresh)
+	rg.POST("/logout", authRequired, h.Logout)
+	rg.POST("/logout-all", authRequired, h.LogoutAll)
+	rg.POST("/forgot-password", h.ForgotPassword)
+	rg.POST("/reset-password", h.ResetPassword)
+
+	// The caller's own account
+	rg.GET("/me", authRequired, h.GetMe)
+	rg.PATCH("/me", authRequired, h.UpdateMe)
+	rg.POST("/me/password", authRequired, h.ChangePassword)
+	rg.DELETE("/me", authRequired, h.DeleteMe)
+
+	// Two-factor authentication; /2fa/enroll again while enabled to re-enroll
+	rg.POST("/2fa/verify", h.VerifyTwoFactor)
+	rg.POST("/2fa/enroll", authRequired, h.EnrollTwoFactor)
+	rg.POST("/2fa/enable", authRequired, h.EnableTwoFactor)
+	rg.POST("/2fa/disable", authRequired, h.DisableTwoFactor)
+
+	// Personal access tokens for scripts and CI
+	rg.GET("/tokens", authRequired, h.ListAccessTokens)
+	rg.POST("/tokens", authRequired, h.CreateAccessToken)
+	rg.DELETE("/tokens/:id", authRequired, h.RevokeAccessToken)
+
+	// Single sign-on through an OpenID Connect provider
+	rg.GET("/oidc/login", h.SSOLogin)
+	rg.GET("/oidc/callback", h.SSOCallback)
+	rg.POST("/oidc/token", h.SSOToken)
 }
@@ -0,0 +1,253 @@
+// Package mockidp is a minimal OpenID Connect provider for tests and local
+// development. It supports discovery, the authorization code flow with PKCE
+// (S256 only) and RS256 ID tokens, and signs in whoever User currently is
+// without asking for credentials. Never expose it to real users.
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"gotasks/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock"
+
+// User is the identity the provider asserts at the next login.
+type User struct {
+	Subject           string
+	PreferredUsername string
+	Email             string
+	EmailVerified     bool
+	Groups            []string
+}
+
+// IdP is an http.Handler serving the provider endpoints under its issuer URL.
+type IdP struct {
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	issuer string
+	user   User
+	priv   *rsa.PrivateKey
+	jwks   utils.JWKS
+	grants map[string]grant
+}
+
+type grant struct {
+	user        User
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+// New returns a provider that will claim to be issuer.
+func New(issuer, clientID, clientSecret string) (*IdP, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.NewRSAKey(keyID, priv, nil)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := utils.NewKeySet(keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		issuer:       issuer,
+		priv:         priv,
+		jwks:         keys.JWKS(),
+		grants:       make(map[string]grant),
+		user:         User{Subject: "mock-user", PreferredUsername: "mockuser", Email: "mockuser@example.com", EmailVerified: true},
+	}, nil
+}
+
+// NewServer starts a provider on a local test server whose URL is the issuer.
+// Callers must Close the returned server.
+func NewServer(clientID, clientSecret string) (*IdP, *httptest.Server, error) {
+	idp, err := New("", clientID, clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv := httptest.NewServer(idp)
+	idp.mu.Lock()
+	idp.issuer = srv.URL
+	idp.mu.Unlock()
+	return idp, srv, nil
+}
+
+// Issuer returns the issuer URL the provider claims.
+func (p *IdP) Issuer() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.issuer
+}
+
+// SetUser changes who is signed in by the next authorization request.
+func (p *IdP) SetUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = u
+}
+
+func (p *IdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		p.discovery(w)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, p.jwks)
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *IdP) discovery(w http.ResponseWriter) {
+	issuer := p.Issuer()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize signs the current user in immediately and redirects back with a
+// code, as a real provider would after its login page.
+func (p *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID {
+		http.Error(w, "invalid client or response_type", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := utils.NewOpaqueToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.grants[code] = grant{
+		user:        p.user,
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use, as in any real provider
+	p.mu.Lock()
+	g, found := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	issuer := p.issuer
+	p.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || !found || time.Now().After(g.expiresAt) ||
+		g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                issuer,
+		"sub":                g.user.Subject,
+		"aud":                clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"preferred_username": g.user.PreferredUsername,
+		"email":              g.user.Email,
+		"email_verified":     g.user.EmailVerified,
+		"groups":             g.user.Groups,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(p.priv)
+	if err != nil {
+		tokenError(w, "server_error")
+		return
+	}
+
+	accessToken, _ := utils.NewOpaqueToken()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
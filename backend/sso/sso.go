@@ -0,0 +1,187 @@
+// Package sso signs users in through an external OpenID Connect identity
+// provider using the authorization code flow with PKCE. It discovers the
+// provider's endpoints, verifies ID tokens and nonces, and maps the
+// provider's groups to GoTasks roles. Provisioning users is left to callers.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gotasks/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoRole means the user belongs to none of the groups allowed to sign in.
+var ErrNoRole = errors.New("user is not in a group allowed to sign in")
+
+// Config describes the identity provider and how its users map to roles.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback, registered with the provider.
+	RedirectURL string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string
+	// AdminGroups grant RoleAdmin. UserGroups grant RoleUser; when empty,
+	// every user the provider authenticates gets RoleUser.
+	AdminGroups []string
+	UserGroups  []string
+}
+
+// Identity is what the provider asserts about a signed-in user.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	PreferredUsername string
+	Email             string
+	EmailVerified     bool
+	Groups            []string
+}
+
+// Client runs the login flow against one provider. Discovery happens on
+// first use and is retried until it succeeds, so the API can start while the
+// provider is unreachable.
+type Client struct {
+	cfg Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &Client{cfg: cfg}
+}
+
+func (c *Client) discover(ctx context.Context) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider == nil {
+		p, err := oidc.NewProvider(ctx, c.cfg.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		c.provider = p
+	}
+	return c.provider, nil
+}
+
+func (c *Client) oauth2Config(p *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		RedirectURL:  c.cfg.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, c.cfg.Scopes...),
+	}
+}
+
+// AuthCodeURL returns the provider URL to send the browser to. state and
+// nonce must be random and remembered with verifier (see
+// oauth2.GenerateVerifier) until the callback.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.oauth2Config(p).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code from the callback, verifies the ID
+// token's signature, issuer, audience, expiry and nonce, and returns the
+// identity it asserts.
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	p, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.oauth2Config(p).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := p.Verifier(&oidc.Config{ClientID: c.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %w", err)
+	}
+	if idToken.Nonce == "" || idToken.Nonce != nonce {
+		return nil, errors.New("oidc: id_token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: %w", err)
+	}
+
+	identity := &Identity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		PreferredUsername: stringClaim(claims, "preferred_username"),
+		Email:             stringClaim(claims, "email"),
+		Groups:            stringsClaim(claims, c.cfg.GroupsClaim),
+	}
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	return identity, nil
+}
+
+// RoleFor maps the identity's groups to a role. Admin groups win over user
+// groups; ErrNoRole is returned when neither applies.
+func (c *Client) RoleFor(identity *Identity) (string, error) {
+	if containsAny(identity.Groups, c.cfg.AdminGroups) {
+		return models.RoleAdmin, nil
+	}
+	if len(c.cfg.UserGroups) == 0 || containsAny(identity.Groups, c.cfg.UserGroups) {
+		return models.RoleUser, nil
+	}
+	return "", ErrNoRole
+}
+
+func containsAny(have, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that providers send either as a list of strings
+// or as a single string.
+func stringsClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gotasks/models"
+	"gotasks/sso/mockidp"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestClient(t *testing.T) (*Client, *mockidp.IdP) {
+	t.Helper()
+	idp, srv, err := mockidp.NewServer("gotasks", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	client := NewClient(Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "gotasks",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:       []string{"profile", "email"},
+		AdminGroups:  []string{"gotasks-admins"},
+	})
+	return client, idp
+}
+
+// authorize plays the browser: it follows the login URL to the provider and
+// returns the code and state the provider redirects back with.
+func authorize(t *testing.T, loginURL string) (code, state string) {
+	t.Helper()
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := noRedirect.Get(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want 302", res.StatusCode)
+	}
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestLoginFlow(t *testing.T) {
+	client, idp := newTestClient(t)
+	idp.SetUser(mockidp.User{Subject: "42", PreferredUsername: "alice", Email: "alice@example.com", EmailVerified: true, Groups: []string{"gotasks-admins"}})
+	ctx := context.Background()
+
+	verifier := oauth2.GenerateVerifier()
+	loginURL, err := client.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, state := authorize(t, loginURL)
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+
+	identity, err := client.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if identity.Issuer != idp.Issuer() || identity.Subject != "42" || identity.PreferredUsername != "alice" || !identity.EmailVerified {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+	if role, err := client.RoleFor(identity); err != nil || role != models.RoleAdmin {
+		t.Errorf("RoleFor() = %q, %v; want admin", role, err)
+	}
+
+	// Codes are single use
+	if _, err := client.Exchange(ctx, code, verifier, "nonce-1"); err == nil {
+		t.Error("authorization code redeemed twice")
+	}
+}
+
+func TestExchangeRejectsTampering(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		verifier func(original string) string
+		nonce    string
+	}{
+		{name: "Wrong PKCE verifier", verifier: func(string) string { return oauth2.GenerateVerifier() }, nonce: "nonce-1"},
+		{name: "Wrong nonce", verifier: func(v string) string { return v }, nonce: "nonce-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := oauth2.GenerateVerifier()
+			loginURL, err := client.AuthCodeURL(ctx, "state", "nonce-1", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := authorize(t, loginURL)
+			if _, err := client.Exchange(ctx, code, tt.verifier(verifier), tt.nonce); err == nil {
+				t.Error("Exchange() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRoleFor(t *testing.T) {
+	restricted := NewClient(Config{AdminGroups: []string{"admins"}, UserGroups: []string{"staff"}})
+	open := NewClient(Config{AdminGroups: []string{"admins"}})
+
+	tests := []struct {
+		name    string
+		client  *Client
+		groups  []string
+		want    string
+		wantErr error
+	}{
+		{name: "Admin group", client: restricted, groups: []string{"staff", "admins"}, want: models.RoleAdmin},
+		{name: "User group", client: restricted, groups: []string{"staff"}, want: models.RoleUser},
+		{name: "No allowed group", client: restricted, groups: []string{"contractors"}, wantErr: ErrNoRole},
+		{name: "Anyone may sign in", client: open, groups: nil, want: models.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.RoleFor(&Identity{Groups: tt.groups})
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("RoleFor() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
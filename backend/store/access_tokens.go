@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gotasks/models"
+	"gotasks/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lastUsedGranularity limits how often using a token writes its LastUsedAt,
+// so busy scripts do not cause a write per request.
+const lastUsedGranularity = time.Minute
+
+// AccessToken is a personal access token. Only its hash is stored; the plain
+// token is shown once, when it is created.
+type AccessToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	Name      string             `bson:"name" json:"name"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	// Hint is the start of the token, to help users recognise it.
+	Hint       string     `bson:"hint" json:"hint"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expiresAt" json:"expiresAt"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+}
+
+// AccessTokenStore creates, lists, revokes and authenticates personal access
+// tokens. Authenticating looks up the owner in users so role changes and
+// deletions take effect immediately.
+type AccessTokenStore struct {
+	col   *mongo.Collection
+	users *mongo.Collection
+}
+
+func NewAccessTokenStore(col, users *mongo.Collection) *AccessTokenStore {
+	return &AccessTokenStore{col: col, users: users}
+}
+
+// EnsureIndexes creates the lookup indexes and a TTL index so expired tokens
+// are purged by MongoDB.
+func (s *AccessTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Create issues a token for userID and returns the plain token with its record.
+func (s *AccessTokenStore) Create(ctx context.Context, userID primitive.ObjectID, name string, scopes []string, expiresAt time.Time) (string, *AccessToken, error) {
+	secret, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := utils.AccessTokenPrefix + secret
+
+	at := &AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: utils.HashToken(token),
+		Hint:      token[:len(utils.AccessTokenPrefix)+4],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.col.InsertOne(ctx, at); err != nil {
+		return "", nil, err
+	}
+	return token, at, nil
+}
+
+// List returns userID's unexpired tokens, newest first.
+func (s *AccessTokenStore) List(ctx context.Context, userID primitive.ObjectID) ([]AccessToken, error) {
+	cursor, err := s.col.Find(ctx,
+		bson.M{"userId": userID, "expiresAt": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []AccessToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke deletes one of userID's tokens and reports whether it existed.
+func (s *AccessTokenStore) Revoke(ctx context.Context, userID, tokenID primitive.ObjectID) (bool, error) {
+	res, err := s.col.DeleteOne(ctx, bson.M{"_id": tokenID, "userId": userID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+// RevokeUser deletes every token of userID.
+func (s *AccessTokenStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.col.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+// Authenticate returns claims for a valid token, carrying the owner's current
+// role and the token's scopes, and records when it was used. Unknown and
+// expired tokens, and tokens of deleted users, give utils.ErrInvalidToken.
+func (s *AccessTokenStore) Authenticate(ctx context.Context, token string) (*utils.Claims, error) {
+	now := time.Now()
+
+	var at AccessToken
+	err := s.col.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(token), "expiresAt": bson.M{"$gt": now}}).Decode(&at)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, utils.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = s.users.FindOne(ctx, bson.M{"_id": at.UserID}, options.FindOne().SetProjection(bson.M{"username": 1, "role": 1, "disabled": 1})).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) || user.Disabled {
+		return nil, utils.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if at.LastUsedAt == nil || now.Sub(*at.LastUsedAt) >= lastUsedGranularity {
+		if _, err := s.col.UpdateOne(ctx, bson.M{"_id": at.ID}, bson.M{"$set": bson.M{"lastUsedAt": now}}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &utils.Claims{
+		UserID:   user.ID.Hex(),
+		Username: user.Username,
+		Role:     user.Role,
+		// Never nil, so an empty list grants nothing rather than everything
+		Scopes: append([]string{}, at.Scopes...),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        at.ID.Hex(),
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(at.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(at.ExpiresAt),
+		},
+	}, nil
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gotasks/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrResetTokenInvalid covers unknown, expired and already used reset tokens.
+var ErrResetTokenInvalid = errors.New("invalid or expired password reset token")
+
+// PasswordReset is the server-side record of a password reset token. Only the
+// token's hash is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"tokenHash"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+}
+
+// PasswordResetStore issues single-use password reset tokens that expire
+// after ttl. Each user has at most one outstanding token.
+type PasswordResetStore struct {
+	col *mongo.Collection
+	ttl time.Duration
+}
+
+func NewPasswordResetStore(col *mongo.Collection, ttl time.Duration) *PasswordResetStore {
+	return &PasswordResetStore{col: col, ttl: ttl}
+}
+
+// TTL is how long a reset token stays valid.
+func (s *PasswordResetStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// EnsureIndexes creates the lookup indexes and a TTL index so expired tokens
+// are purged by MongoDB.
+func (s *PasswordResetStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Issue returns a new plain reset token for userID, invalidating any earlier
+// one that was not used yet.
+func (s *PasswordResetStore) Issue(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	if _, err := s.col.DeleteMany(ctx, bson.M{"userId": userID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		return "", err
+	}
+
+	token, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = s.col.InsertOne(ctx, PasswordReset{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Lookup returns the user a valid token was issued to without using it up,
+// so the new password can be checked before the token is spent.
+func (s *PasswordResetStore) Lookup(ctx context.Context, token string) (primitive.ObjectID, error) {
+	var reset PasswordReset
+	err := s.col.FindOne(ctx, bson.M{
+		"tokenHash": utils.HashToken(token),
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&reset)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return reset.UserID, nil
+}
+
+// Consume marks a valid token as used and returns the user it was issued to.
+// The update is atomic, so a token can only ever be redeemed once.
+func (s *PasswordResetStore) Consume(ctx context.Context, token string) (primitive.ObjectID, error) {
+	now := time.Now()
+
+	var reset PasswordReset
+	err := s.col.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": utils.HashToken(token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&reset)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return reset.UserID, nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gotasks/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrRefreshTokenInvalid covers unknown, expired and revoked refresh tokens.
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused means an already rotated token was presented
+	// again; its whole family has been revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is the server-side record of an opaque refresh token. Only the
+// token's hash is stored. Tokens produced by rotating one another share a
+// FamilyID, which lets reuse of any of them revoke the whole chain.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"tokenHash"`
+	FamilyID  string             `bson:"familyId"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	RotatedAt *time.Time         `bson:"rotatedAt,omitempty"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty"`
+}
+
+// RefreshTokenStore issues, rotates and revokes refresh tokens in MongoDB.
+// An unused token stays valid for ttl; every rotation starts a new period, so
+// active users stay signed in.
+type RefreshTokenStore struct {
+	col *mongo.Collection
+	ttl time.Duration
+}
+
+func NewRefreshTokenStore(col *mongo.Collection, ttl time.Duration) *RefreshTokenStore {
+	return &RefreshTokenStore{col: col, ttl: ttl}
+}
+
+// TTL is how long an unused refresh token stays valid.
+func (s *RefreshTokenStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// EnsureIndexes creates the lookup index on the token hash and a TTL index
+// so expired tokens are purged by MongoDB.
+func (s *RefreshTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "familyId", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Issue starts a new token family for userID and returns the plain token.
+func (s *RefreshTokenStore) Issue(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	return s.issue(ctx, userID, primitive.NewObjectID().Hex())
+}
+
+// Rotate exchanges a valid refresh token for a new one in the same family and
+// returns the owning user's ID. Presenting a token that was already rotated is
+// treated as theft: the whole family is revoked and ErrRefreshTokenReused is
+// returned.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token string) (primitive.ObjectID, string, error) {
+	now := time.Now()
+	hash := utils.HashToken(token)
+
+	// Atomically claim the token so two concurrent rotations cannot both succeed
+	var current RefreshToken
+	err := s.col.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hash,
+			"rotatedAt": bson.M{"$exists": false},
+			"revokedAt": bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"rotatedAt": now}},
+	).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, "", s.explainRejection(ctx, hash)
+	}
+	if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+
+	next, err := s.issue(ctx, current.UserID, current.FamilyID)
+	if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+	return current.UserID, next, nil
+}
+
+// RevokeFamily revokes every token rotated from the same login as token.
+// Unknown tokens are ignored.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, token string) error {
+	var rt RefreshToken
+	err := s.col.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(token)}).Decode(&rt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revoke(ctx, bson.M{"familyId": rt.FamilyID})
+}
+
+// RevokeUser revokes every refresh token belonging to userID.
+func (s *RefreshTokenStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	return s.revoke(ctx, bson.M{"userId": userID})
+}
+
+func (s *RefreshTokenStore) issue(ctx context.Context, userID primitive.ObjectID, familyID string) (string, error) {
+	token, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = s.col.InsertOne(ctx, RefreshToken{
+		TokenHash: utils.HashToken(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// explainRejection works out why a token could not be rotated and, if it had
+// already been rotated, revokes its family.
+func (s *RefreshTokenStore) explainRejection(ctx context.Context, hash string) error {
+	var rt RefreshToken
+	err := s.col.FindOne(ctx, bson.M{"tokenHash": hash}).Decode(&rt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if rt.RotatedAt != nil && rt.RevokedAt == nil {
+		if err := s.revoke(ctx, bson.M{"familyId": rt.FamilyID}); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	return ErrRefreshTokenInvalid
+}
+
+func (s *RefreshTokenStore) revoke(ctx context.Context, filter bson.M) error {
+	filter["revokedAt"] = bson.M{"$exists": false}
+	_, err := s.col.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	return err
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gotasks/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevocationStore records access tokens that must be rejected before they
+// expire: single tokens by jti (logout) and, per user, every token issued
+// up to a cut-off time (log out everywhere). Both collections carry TTL
+// indexes, so entries disappear once the tokens they cover would have expired
+// anyway; accessTTL must therefore match the access token lifetime.
+type RevocationStore struct {
+	tokens    *mongo.Collection
+	cutoffs   *mongo.Collection
+	accessTTL time.Duration
+}
+
+func NewRevocationStore(tokens, cutoffs *mongo.Collection, accessTTL time.Duration) *RevocationStore {
+	return &RevocationStore{tokens: tokens, cutoffs: cutoffs, accessTTL: accessTTL}
+}
+
+type revokedToken struct {
+	JTI       string    `bson:"_id"`
+	UserID    string    `bson:"userId"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// tokenCutoff revokes every token of a user issued at or before Through.
+// Through is kept at whole seconds, the precision of iat; the field keeps the
+// name it had when the cut-off was exclusive.
+type tokenCutoff struct {
+	UserID    string    `bson:"_id"`
+	Through   time.Time `bson:"notBefore"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// EnsureIndexes creates the TTL indexes that purge stale revocations.
+func (s *RevocationStore) EnsureIndexes(ctx context.Context) error {
+	ttl := mongo.IndexModel{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+	if _, err := s.tokens.Indexes().CreateOne(ctx, ttl); err != nil {
+		return err
+	}
+	_, err := s.cutoffs.Indexes().CreateOne(ctx, ttl)
+	return err
+}
+
+// RevokeToken rejects the token with the given claims until it expires.
+func (s *RevocationStore) RevokeToken(ctx context.Context, claims *utils.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token has no jti or expiry")
+	}
+	doc := revokedToken{JTI: claims.ID, UserID: claims.UserID, ExpiresAt: claims.ExpiresAt.Time}
+	_, err := s.tokens.ReplaceOne(ctx, bson.M{"_id": doc.JTI}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// RevokeAll rejects every token of userID issued up to and including at, to
+// the second. Since iat has second precision this also rejects tokens issued
+// later in that same second, so callers that immediately issue the user a
+// new token should use RevokeAllBefore instead.
+func (s *RevocationStore) RevokeAll(ctx context.Context, userID string, at time.Time) error {
+	return s.revokeThrough(ctx, userID, throughAll(at))
+}
+
+// RevokeAllBefore rejects every token of userID issued before notBefore.
+// A token issued in the same second as notBefore cannot be told apart from
+// one issued just after it, so it is still accepted.
+func (s *RevocationStore) RevokeAllBefore(ctx context.Context, userID string, notBefore time.Time) error {
+	return s.revokeThrough(ctx, userID, throughBefore(notBefore))
+}
+
+// throughAll and throughBefore turn the times given to RevokeAll and
+// RevokeAllBefore into the last second whose tokens are revoked.
+func throughAll(at time.Time) time.Time {
+	return at.Truncate(time.Second)
+}
+
+func throughBefore(notBefore time.Time) time.Time {
+	return notBefore.Truncate(time.Second).Add(-time.Second)
+}
+
+func (s *RevocationStore) revokeThrough(ctx context.Context, userID string, through time.Time) error {
+	// Keep the later of an existing and the new cut-off
+	_, err := s.cutoffs.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$max": bson.M{
+			"notBefore": through,
+			"expiresAt": through.Add(time.Second + s.accessTTL),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsRevoked reports whether the token with the given claims has been revoked.
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	err := s.tokens.FindOne(ctx, bson.M{"_id": claims.ID}).Err()
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, err
+	}
+
+	var cutoff tokenCutoff
+	err = s.cutoffs.FindOne(ctx, bson.M{"_id": claims.UserID}).Decode(&cutoff)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return revokedBy(claims, cutoff), nil
+}
+
+// revokedBy reports whether cutoff covers the token with the given claims.
+// Tokens without iat predate every cut-off.
+func revokedBy(claims *utils.Claims, cutoff tokenCutoff) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return !claims.IssuedAt.Time.After(cutoff.Through)
+}
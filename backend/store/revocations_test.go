@@ -0,0 +1,47 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"gotasks/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRevokedBy(t *testing.T) {
+	// Cut-offs made half a second into 12:00:00
+	at := time.Date(2026, 10, 18, 12, 0, 0, 500_000_000, time.UTC)
+	all := tokenCutoff{Through: throughAll(at)}
+	before := tokenCutoff{Through: throughBefore(at)}
+
+	issued := func(t time.Time) *utils.Claims {
+		return &utils.Claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(t)}}
+	}
+	earlier := issued(at.Add(-2 * time.Second))
+	sameSecond := issued(at.Add(-100 * time.Millisecond))
+	later := issued(at.Add(time.Second))
+
+	tests := []struct {
+		name   string
+		cutoff tokenCutoff
+		claims *utils.Claims
+		want   bool
+	}{
+		{"RevokeAll: earlier token", all, earlier, true},
+		{"RevokeAll: token from the same second", all, sameSecond, true},
+		{"RevokeAll: later token", all, later, false},
+		{"RevokeAllBefore: earlier token", before, earlier, true},
+		{"RevokeAllBefore: token from the same second", before, sameSecond, false},
+		{"RevokeAllBefore: later token", before, later, false},
+		{"Token without iat", all, &utils.Claims{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revokedBy(tt.claims, tt.cutoff); got != tt.want {
+				t.Errorf("revokedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
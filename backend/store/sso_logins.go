@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gotasks/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSSOLoginInvalid covers unknown, expired and already used single sign-on
+// states and hand-off codes.
+var ErrSSOLoginInvalid = errors.New("invalid or expired single sign-on login")
+
+const (
+	// ssoStateTTL bounds how long a user may take at the identity provider.
+	ssoStateTTL = 10 * time.Minute
+	// ssoHandoffTTL bounds how long the frontend may take to redeem the
+	// code it receives after a successful sign-in.
+	ssoHandoffTTL = time.Minute
+
+	ssoKindState   = "state"
+	ssoKindHandoff = "handoff"
+)
+
+// ssoLogin is one step of a single sign-on login. A "state" record keeps the
+// nonce and PKCE verifier while the user is at the provider; a "handoff"
+// record lets the frontend exchange a one-time code for tokens afterwards.
+// Only hashes of the state and code are stored.
+type ssoLogin struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Kind      string             `bson:"kind"`
+	TokenHash string             `bson:"tokenHash"`
+	Nonce     string             `bson:"nonce,omitempty"`
+	Verifier  string             `bson:"verifier,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId,omitempty"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
+
+// SSOLoginStore keeps the short-lived, single-use records of single sign-on
+// logins in progress.
+type SSOLoginStore struct {
+	col *mongo.Collection
+}
+
+func NewSSOLoginStore(col *mongo.Collection) *SSOLoginStore {
+	return &SSOLoginStore{col: col}
+}
+
+// EnsureIndexes creates the lookup index and a TTL index so abandoned logins
+// are purged by MongoDB.
+func (s *SSOLoginStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// SaveState remembers the nonce and PKCE verifier of a login that was sent
+// to the provider with the given state.
+func (s *SSOLoginStore) SaveState(ctx context.Context, state, nonce, verifier string) error {
+	_, err := s.col.InsertOne(ctx, ssoLogin{
+		Kind:      ssoKindState,
+		TokenHash: utils.HashToken(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(ssoStateTTL),
+	})
+	return err
+}
+
+// TakeState consumes the record saved for state and returns its nonce and
+// verifier, so each state completes at most one login.
+func (s *SSOLoginStore) TakeState(ctx context.Context, state string) (nonce, verifier string, err error) {
+	login, err := s.take(ctx, ssoKindState, state)
+	if err != nil {
+		return "", "", err
+	}
+	return login.Nonce, login.Verifier, nil
+}
+
+// IssueHandoff returns a one-time code the frontend redeems for userID's tokens.
+func (s *SSOLoginStore) IssueHandoff(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	code, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = s.col.InsertOne(ctx, ssoLogin{
+		Kind:      ssoKindHandoff,
+		TokenHash: utils.HashToken(code),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ssoHandoffTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemHandoff consumes a hand-off code and returns the user it was issued for.
+func (s *SSOLoginStore) RedeemHandoff(ctx context.Context, code string) (primitive.ObjectID, error) {
+	login, err := s.take(ctx, ssoKindHandoff, code)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return login.UserID, nil
+}
+
+func (s *SSOLoginStore) take(ctx context.Context, kind, token string) (*ssoLogin, error) {
+	var login ssoLogin
+	err := s.col.FindOneAndDelete(ctx, bson.M{
+		"kind":      kind,
+		"tokenHash": utils.HashToken(token),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&login)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSSOLoginInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
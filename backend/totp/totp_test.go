@@ -0,0 +1,113 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA-1.
+func TestHOTPMatchesRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := hotp(key, uint64(Step(time.Unix(tt.unix, 0))), 8); got != tt.want {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Fatalf("Code = %s, want 287082", code)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{name: "Current period", code: code, at: now, wantOK: true},
+		{name: "One period late", code: code, at: now.Add(Period), wantOK: true},
+		{name: "Two periods late", code: code, at: now.Add(2 * Period), wantOK: false},
+		{name: "Wrong code", code: "000000", at: now, wantOK: false},
+		{name: "Wrong length", code: "28708", at: now, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, tt.at)
+			if ok != tt.wantOK {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != Step(now) {
+				t.Errorf("Validate step = %d, want %d", step, Step(now))
+			}
+		})
+	}
+}
+
+func TestGenerateSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret length = %d, want 32", len(secret))
+	}
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(secret, code, time.Now()); !ok {
+		t.Error("freshly generated code did not validate")
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("GoTasks", "alice", "JBSWY3DPEHPK3PXP")
+	for _, want := range []string{"otpauth://totp/GoTasks:alice?", "secret=JBSWY3DPEHPK3PXP", "issuer=GoTasks", "digits=6", "period=30"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("URI %q is missing %q", got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not shaped like abcde-fghjk", code)
+		}
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))) != code {
+			t.Errorf("code %q does not survive normalization", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != RecoveryCodeCount {
+		t.Errorf("got %d distinct codes, want %d", len(seen), RecoveryCodeCount)
+	}
+}
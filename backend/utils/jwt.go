@@ -1,31 +1,167 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("your-secret-key") // Replace with a secure key and put in env later
+// ErrInvalidToken is returned by ParseJWT for any token that is malformed,
+// expired, signed with an unknown key or algorithm, or missing required claims.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ChallengeAudience marks tokens that only prove the password step of a
+// two-factor login. ParseJWT rejects them, so they never grant API access.
+const ChallengeAudience = "gotasks:2fa"
 
 type Claims struct {
+	UserID   string `json:"uid"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// Scopes limits what a personal access token may do. It is nil for
+	// interactive sessions, which are limited only by the user's role.
+	Scopes []string `json:"scopes,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(username, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token valid for 1 day
+// HasScope reports whether the credential may be used for scope.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAccessToken reports whether the claims came from a personal access token
+// rather than an interactive login.
+func (c *Claims) IsAccessToken() bool {
+	return c.Scopes != nil
+}
+
+// JWTManager signs and verifies access tokens with a KeySet. Tokens are
+// short-lived because clients renew them with a refresh token.
+type JWTManager struct {
+	keys *KeySet
+	ttl  time.Duration
+}
+
+func NewJWTManager(keys *KeySet, ttl time.Duration) *JWTManager {
+	return &JWTManager{keys: keys, ttl: ttl}
+}
+
+// TTL returns the lifetime of the tokens this manager issues.
+func (m *JWTManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// JWKS returns the public keys other services can verify our tokens with.
+func (m *JWTManager) JWKS() JWKS {
+	return m.keys.JWKS()
+}
+
+// GenerateJWT signs an access token for the user with the active key and
+// names that key in the "kid" header.
+func (m *JWTManager) GenerateJWT(userID, username, role string) (string, error) {
+	now := time.Now()
+
+	// jti identifies this token so it can be revoked on logout
+	jti, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
 
 	claims := &Claims{
+		UserID:   userID,
 		Username: username,
 		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	key := m.keys.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// ParseJWT verifies the signature and expiry of a token produced by
+// GenerateJWT and returns its claims. The key is chosen by the token's "kid"
+// header and must use the algorithm the token claims.
+func (m *JWTManager) ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithExpirationRequired(),
+	)
+	// Access tokens carry no audience; anything else is a different kind of token
+	if err != nil || !token.Valid || claims.UserID == "" || claims.ID == "" || claims.IssuedAt == nil || len(claims.Audience) != 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// GenerateChallenge signs a token valid for ttl that lets the user finish a
+// two-factor login by presenting a code.
+func (m *JWTManager) GenerateChallenge(userID, username string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	jti, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &Claims{
+		UserID:   userID,
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{ChallengeAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	key := m.keys.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// ParseChallenge verifies a token produced by GenerateChallenge.
+func (m *JWTManager) ParseChallenge(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(ChallengeAudience),
+	)
+	if err != nil || !token.Valid || claims.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// keyFunc picks the verification key named by the token's "kid" header and
+// checks that the token uses that key's algorithm.
+func (m *JWTManager) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := m.keys.Lookup(kid)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	// Never let the token pick the algorithm for a key
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("algorithm does not match key")
+	}
+	return key.public, nil
 }
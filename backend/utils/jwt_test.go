@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeySet(t *testing.T, active string, keys ...*SigningKey) *KeySet {
+	t.Helper()
+	ks, err := NewKeySet(active, keys...)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	return ks
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	hs, _ := NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	rs, _ := NewRSAKey("rs", rsaKey, nil)
+	ed, _ := NewEd25519Key("ed", edKey, nil)
+
+	for _, key := range []*SigningKey{hs, rs, ed} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			m := NewJWTManager(newTestKeySet(t, key.ID, key), time.Minute)
+
+			token, err := m.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+			if err != nil {
+				t.Fatalf("GenerateJWT() error = %v", err)
+			}
+			claims, err := m.ParseJWT(token)
+			if err != nil {
+				t.Fatalf("ParseJWT() error = %v", err)
+			}
+			if claims.Username != "alice" || claims.ID == "" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	_, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	_, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey, _ := NewEd25519Key("old", oldPriv, nil)
+	newKey, _ := NewEd25519Key("new", newPriv, nil)
+
+	before := NewJWTManager(newTestKeySet(t, "old", oldKey), time.Minute)
+	issued, _ := before.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+
+	// After rotation the old key is kept as verify-only
+	retired, _ := NewEd25519Key("old", nil, oldPriv.Public().(ed25519.PublicKey))
+	after := NewJWTManager(newTestKeySet(t, "new", newKey, retired), time.Minute)
+	if _, err := after.ParseJWT(issued); err != nil {
+		t.Errorf("token signed by retired key rejected: %v", err)
+	}
+
+	// Once the old key is dropped its tokens stop verifying
+	dropped := NewJWTManager(newTestKeySet(t, "new", newKey), time.Minute)
+	if _, err := dropped.ParseJWT(issued); err == nil {
+		t.Error("token signed by removed key accepted")
+	}
+
+	if _, err := NewKeySet("old", retired); err == nil {
+		t.Error("verify-only key accepted as active key")
+	}
+}
+
+func TestChallengeTokensAreSeparateFromAccessTokens(t *testing.T) {
+	hs, _ := NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	m := NewJWTManager(newTestKeySet(t, "hs", hs), time.Minute)
+
+	challenge, err := m.GenerateChallenge("507f1f77bcf86cd799439011", "alice", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateChallenge() error = %v", err)
+	}
+	claims, err := m.ParseChallenge(challenge)
+	if err != nil {
+		t.Fatalf("ParseChallenge() error = %v", err)
+	}
+	if claims.Username != "alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if _, err := m.ParseJWT(challenge); err == nil {
+		t.Error("challenge token accepted as access token")
+	}
+
+	access, _ := m.GenerateJWT("507f1f77bcf86cd799439011", "alice", "user")
+	if _, err := m.ParseChallenge(access); err == nil {
+		t.Error("access token accepted as challenge token")
+	}
+}
+
+func TestJWTRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rs, _ := NewRSAKey("rs", rsaKey, nil)
+	m := NewJWTManager(newTestKeySet(t, "rs", rs), time.Minute)
+
+	// An HS256 token "signed" with the RSA public key must not verify
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: "507f1f77bcf86cd799439011",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "forged",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	forged.Header["kid"] = "rs"
+	signed, _ := forged.SignedString(pubDER)
+
+	if _, err := m.ParseJWT(signed); err == nil {
+		t.Error("HS256 token accepted for an RS256 key")
+	}
+}
+
+func TestLoadSigningKeyAndJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaPath := writePEM("rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edPath := writePEM("ed.pem", "PRIVATE KEY", edDER)
+
+	rs, err := LoadSigningKey(KeySpec{ID: "rs", Algorithm: AlgRS256, File: rsaPath})
+	if err != nil {
+		t.Fatalf("loading RSA key: %v", err)
+	}
+	ed, err := LoadSigningKey(KeySpec{Algorithm: AlgEdDSA, File: edPath})
+	if err != nil {
+		t.Fatalf("loading Ed25519 key: %v", err)
+	}
+	if ed.ID == "" {
+		t.Error("expected a fingerprint kid for a key without ID")
+	}
+	if _, err := LoadSigningKey(KeySpec{ID: "bad", Algorithm: AlgEdDSA, File: rsaPath}); err == nil {
+		t.Error("RSA PEM accepted for EdDSA")
+	}
+	if _, err := LoadSigningKey(KeySpec{ID: "short", Algorithm: AlgHS256, Secret: "too-short"}); err == nil {
+		t.Error("short HS256 secret accepted")
+	}
+	if _, err := LoadSigningKey(KeySpec{Algorithm: AlgHS256, Secret: "0123456789abcdef0123456789abcdef"}); err == nil {
+		t.Error("HS256 key without ID accepted; its kid would be derived from the secret")
+	}
+
+	hs, _ := NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	jwks := newTestKeySet(t, "rs", rs, ed, hs).JWKS()
+
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 public keys (HMAC excluded), got %d", len(jwks.Keys))
+	}
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			if k.Kid != "rs" || k.N == "" || k.E != "AQAB" {
+				t.Errorf("unexpected RSA JWK: %+v", k)
+			}
+		case "OKP":
+			if k.Crv != "Ed25519" || k.X == "" || k.Alg != AlgEdDSA {
+				t.Errorf("unexpected OKP JWK: %+v", k)
+			}
+		default:
+			t.Errorf("unexpected key type %q", k.Kty)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one JWT key identified by its kid. Verify-only keys (a
+// retired key, or a public key loaded without its private half) have a nil
+// signer and are only used to check signatures.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	signer interface{}
+	public interface{}
+}
+
+// KeySpec describes where to load a key from. HS256 keys take their secret
+// from Secret or, if empty, from the contents of File; RS256 and EdDSA keys
+// read a PEM private (or, for verify-only keys, public) key from File.
+type KeySpec struct {
+	ID        string
+	Algorithm string
+	File      string
+	Secret    string
+}
+
+// LoadSigningKey loads the key described by spec. An empty spec.ID is
+// replaced by a fingerprint of the public key; HS256 keys have no public half,
+// so they need an explicit ID.
+func LoadSigningKey(spec KeySpec) (*SigningKey, error) {
+	switch spec.Algorithm {
+	case AlgHS256:
+		secret := []byte(spec.Secret)
+		if len(secret) == 0 && spec.File != "" {
+			data, err := os.ReadFile(spec.File)
+			if err != nil {
+				return nil, err
+			}
+			secret = []byte(strings.TrimSpace(string(data)))
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("key %q: HS256 secret must be at least 32 bytes", spec.ID)
+		}
+		return newKey(spec.ID, jwt.SigningMethodHS256, secret, secret)
+	case AlgRS256, AlgEdDSA:
+		data, err := os.ReadFile(spec.File)
+		if err != nil {
+			return nil, err
+		}
+		return parsePEMKey(spec.ID, spec.Algorithm, data)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q", spec.ID, spec.Algorithm)
+	}
+}
+
+// NewHMACKey returns an HS256 key for the given secret. id must not be empty.
+func NewHMACKey(id string, secret []byte) (*SigningKey, error) {
+	return newKey(id, jwt.SigningMethodHS256, secret, secret)
+}
+
+// NewRSAKey returns an RS256 key. Pass a nil private key for a verify-only key.
+func NewRSAKey(id string, private *rsa.PrivateKey, public *rsa.PublicKey) (*SigningKey, error) {
+	if private != nil {
+		return newKey(id, jwt.SigningMethodRS256, private, &private.PublicKey)
+	}
+	return newKey(id, jwt.SigningMethodRS256, nil, public)
+}
+
+// NewEd25519Key returns an EdDSA key. Pass a nil private key for a verify-only key.
+func NewEd25519Key(id string, private ed25519.PrivateKey, public ed25519.PublicKey) (*SigningKey, error) {
+	if private != nil {
+		return newKey(id, jwt.SigningMethodEdDSA, private, private.Public())
+	}
+	return newKey(id, jwt.SigningMethodEdDSA, nil, public)
+}
+
+func newKey(id string, method jwt.SigningMethod, signer, public interface{}) (*SigningKey, error) {
+	if public == nil {
+		return nil, errors.New("key has no verification material")
+	}
+	if id == "" {
+		// A kid derived from a secret would publish a hash of it in every token
+		if _, symmetric := public.([]byte); symmetric {
+			return nil, errors.New("HS256 keys need an explicit key ID")
+		}
+		id = fingerprint(public)
+	}
+	// Typed nil private keys must not count as signers
+	if k, ok := signer.(*rsa.PrivateKey); ok && k == nil {
+		signer = nil
+	}
+	if k, ok := signer.(ed25519.PrivateKey); ok && k == nil {
+		signer = nil
+	}
+	return &SigningKey{ID: id, Method: method, signer: signer, public: public}, nil
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.signer != nil
+}
+
+func parsePEMKey(id, alg string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM block found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg == AlgRS256 {
+			return NewRSAKey(id, k, nil)
+		}
+	case *rsa.PublicKey:
+		if alg == AlgRS256 {
+			return NewRSAKey(id, nil, k)
+		}
+	case ed25519.PrivateKey:
+		if alg == AlgEdDSA {
+			return NewEd25519Key(id, k, nil)
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA {
+			return NewEd25519Key(id, nil, k)
+		}
+	}
+	return nil, fmt.Errorf("key %q: PEM key does not match algorithm %s", id, alg)
+}
+
+// fingerprint derives a stable kid from an asymmetric public key.
+func fingerprint(public interface{}) string {
+	material, _ := x509.MarshalPKIXPublicKey(public)
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeySet holds every key tokens may be verified with and the one new tokens
+// are signed with. Rotating keys means adding the new key, making it active,
+// and keeping the old one as verify-only until its tokens have expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeySet builds a key set that signs with the key whose ID is activeID.
+func NewKeySet(activeID string, keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeID)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+// Lookup returns the key with the given kid.
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every asymmetric key. HMAC secrets are
+// never included.
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	doc := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		k := ks.keys[id]
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			doc.Keys = append(doc.Keys, JWK{
+				Kty: "RSA", Kid: k.ID, Use: "sig", Alg: AlgRS256,
+				N: b64(pub.N.Bytes()),
+				E: b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			doc.Keys = append(doc.Keys, JWK{
+				Kty: "OKP", Kid: k.ID, Use: "sig", Alg: AlgEdDSA,
+				Crv: "Ed25519", X: b64(pub),
+			})
+		}
+	}
+	return doc
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
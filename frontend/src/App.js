@@ -7,6 +7,9 @@ import EditTask from './components/EditTask';
 import TaskDetails from './components/Task';
 import LoginForm from './components/LoginForm';
 import SignupForm from './components/SignupForm';
+import ForgotPassword from './components/ForgotPassword';
+import ResetPassword from './components/ResetPassword';
+import SSOCallback from './components/SSOCallback';
 
 
 
@@ -21,6 +24,9 @@ const App = () => {
         <Route path="/details/:id" element={<TaskDetails />} />
         <Route path="/login" element={<LoginForm />} />
         <Route path="/signup" element={<SignupForm />} />
+        <Route path="/forgot-password" element={<ForgotPassword />} />
+        <Route path="/reset-password" element={<ResetPassword />} />
+        <Route path="/sso-callback" element={<SSOCallback />} />
       </Routes>
     </div>
   );
@@ -0,0 +1,62 @@
+// Shared helpers for talking to the GoTasks backend.
+export const API_BASE = 'http://localhost:8080';
+
+// In cookie session mode the backend keeps the tokens in HttpOnly cookies and
+// only hands out a CSRF token, which must accompany every change.
+
+// authHeaders returns request headers carrying the stored JWT or CSRF token, merged with any extras.
+export const authHeaders = (extra = {}) => {
+  const token = localStorage.getItem('token');
+  const csrfToken = localStorage.getItem('csrfToken');
+  const headers = { ...extra };
+  if (token) headers.Authorization = `Bearer ${token}`;
+  if (csrfToken) headers['X-CSRF-Token'] = csrfToken;
+  return headers;
+};
+
+// hasSession reports whether the user is logged in, in either mode.
+export const hasSession = () => Boolean(localStorage.getItem('token') || localStorage.getItem('csrfToken'));
+
+// saveSession stores what login and refresh return: a token pair, or in cookie mode the CSRF token.
+export const saveSession = (data) => {
+  if (data.csrfToken) {
+    localStorage.setItem('csrfToken', data.csrfToken);
+    return;
+  }
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refreshToken', data.refreshToken);
+};
+
+export const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('csrfToken');
+};
+
+// refreshSession swaps the refresh token (stored, or in cookie mode the cookie) for a new session.
+const refreshSession = async () => {
+  const refreshToken = localStorage.getItem('refreshToken');
+  const cookieMode = Boolean(localStorage.getItem('csrfToken'));
+  if (!refreshToken && !cookieMode) return false;
+
+  const res = await fetch(`${API_BASE}/api/auth/refresh`, {
+    method: 'POST',
+    credentials: 'include',
+    headers: authHeaders({ 'Content-Type': 'application/json' }),
+    body: JSON.stringify(cookieMode ? {} : { refreshToken }),
+  });
+  if (!res.ok) {
+    clearSession();
+    return false;
+  }
+  saveSession(await res.json());
+  return true;
+};
+
+// apiFetch is fetch with the session attached; an expired session is renewed once and the request retried.
+export const apiFetch = async (url, options = {}) => {
+  const send = () => fetch(url, { ...options, credentials: 'include', headers: authHeaders(options.headers) });
+  const res = await send();
+  if (res.status !== 401 || !(await refreshSession())) return res;
+  return send();
+};
@@ -1,6 +1,7 @@
 import React, { useState } from 'react';
 import { useNavigate } from 'react-router-dom'; // Import useNavigate
 import './AddTask.css'; // Add this for styling
+import { apiFetch } from '../api';
 
 const AddTask = () => {
   const [taskName, setTaskName] = useState('');
@@ -12,13 +13,17 @@ const AddTask = () => {
 
     const newTask = { title: taskName, description: taskDescription }; // Use state variables
 
-    fetch('http://localhost:8080/tasks', {
+    apiFetch('http://localhost:8080/tasks', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(newTask),
     })
-      .then((response) => response.json())
-      .then((data) => {
+      .then(async (response) => {
+        const data = await response.json();
+        if (!response.ok) {
+          alert(data.error || 'Failed to add task');
+          return;
+        }
         console.log('Task added:', data);
         navigate('/task'); // Redirect to the Task List page after adding a task
       })
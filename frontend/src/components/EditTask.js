@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import './EditTask.css'; // Add this for custom styles
+import { apiFetch } from '../api';
 
 const EditTask = () => {
   const { id } = useParams();
@@ -8,7 +9,7 @@ const EditTask = () => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    fetch(`http://localhost:8080/tasks/${id}`)
+    apiFetch(`http://localhost:8080/tasks/${id}`)
       .then((response) => response.json())
       .then((data) => setTask(data))
       .catch((error) => console.error('Error fetching task:', error));
@@ -17,7 +18,7 @@ const EditTask = () => {
   const handleSubmit = (event) => {
     event.preventDefault();
 
-    fetch(`http://localhost:8080/tasks/${id}`, {
+    apiFetch(`http://localhost:8080/tasks/${id}`, {
       method: 'PUT',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(task),
@@ -0,0 +1,46 @@
+import { useState } from 'react';
+import { Link } from 'react-router-dom';
+import './LoginForm.css';
+import { API_BASE } from '../api';
+
+const ForgotPassword = () => {
+  const [email, setEmail] = useState('');
+  const [sent, setSent] = useState(false);
+
+  const handleSubmit = async e => {
+    e.preventDefault();
+    const res = await fetch(`${API_BASE}/api/auth/forgot-password`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email })
+    });
+
+    if (res.ok) {
+      setSent(true);
+    } else {
+      const data = await res.json();
+      alert(data.error || 'Request failed');
+    }
+  };
+
+  return (
+    <div className="login-container">
+      <div className="login-box">
+        <h2 className="login-title">Forgot Password</h2>
+        {sent ? (
+          <p>If an account uses that email, a reset link is on its way.</p>
+        ) : (
+          <form onSubmit={handleSubmit} className="login-form">
+            <input name="email" type="email" onChange={e => setEmail(e.target.value)} placeholder="Email" required className="login-input" />
+            <button type="submit" className="login-button">Send reset link</button>
+          </form>
+        )}
+        <p className="signup-link">
+          <Link to="/login">Back to login</Link>
+        </p>
+      </div>
+    </div>
+  );
+};
+
+export default ForgotPassword;
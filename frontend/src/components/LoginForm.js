@@ -1,15 +1,18 @@
 import { useState, useEffect } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
 import './LoginForm.css';
+import { API_BASE, hasSession, saveSession } from '../api';
 
 const LoginForm = () => {
   const [form, setForm] = useState({ username: '', password: '' });
+  // Set when the account has two-factor enabled and a code is still needed
+  const [challenge, setChallenge] = useState(null);
+  const [code, setCode] = useState('');
   const navigate = useNavigate();
 
-  // 🧠 Redirect if token already exists
+  // 🧠 Redirect if already logged in
   useEffect(() => {
-    const token = localStorage.getItem('token');
-    if (token) {
+    if (hasSession()) {
       navigate('/tasks');
     }
   }, [navigate]);
@@ -18,17 +21,19 @@ const LoginForm = () => {
 
   const handleSubmit = async e => {
     e.preventDefault();
-    const API_BASE = 'http://localhost:8080';
     const res = await fetch(`${API_BASE}/api/auth/login`, {
       method: 'POST',
+      credentials: 'include', // lets cookie session mode set its cookies
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(form)
     });
 
     const data = await res.json();
 
-    if (res.ok && data.token) {
-      localStorage.setItem('token', data.token);
+    if (res.ok && data.twoFactorRequired) {
+      setChallenge(data.challengeToken);
+    } else if (res.ok) {
+      saveSession(data);
       alert('Login successful!');
       navigate('/tasks');
     } else {
@@ -36,15 +41,50 @@ const LoginForm = () => {
     }
   };
 
+  // Second step: exchange the challenge and an authenticator or recovery code for tokens
+  const handleVerify = async e => {
+    e.preventDefault();
+    const res = await fetch(`${API_BASE}/api/auth/2fa/verify`, {
+      method: 'POST',
+      credentials: 'include',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ challengeToken: challenge, code })
+    });
+
+    const data = await res.json();
+
+    if (res.ok) {
+      saveSession(data);
+      alert('Login successful!');
+      navigate('/tasks');
+    } else {
+      if (data.code === 'challenge_invalid') setChallenge(null);
+      alert(data.error || 'Verification failed');
+    }
+  };
+
   return (
     <div className="login-container">
       <div className="login-box">
         <h2 className="login-title">Login</h2>
-        <form onSubmit={handleSubmit} className="login-form">
-          <input name="username" onChange={handleChange} placeholder="Username" required className="login-input" />
-          <input name="password" type="password" onChange={handleChange} placeholder="Password" required className="login-input" />
-          <button type="submit" className="login-button">Login</button>
-        </form>
+        {challenge ? (
+          <form onSubmit={handleVerify} className="login-form">
+            <input name="code" onChange={e => setCode(e.target.value)} placeholder="Authenticator or recovery code" autoComplete="one-time-code" required className="login-input" />
+            <button type="submit" className="login-button">Verify</button>
+          </form>
+        ) : (
+          <form onSubmit={handleSubmit} className="login-form">
+            <input name="username" onChange={handleChange} placeholder="Username" required className="login-input" />
+            <input name="password" type="password" onChange={handleChange} placeholder="Password" required className="login-input" />
+            <button type="submit" className="login-button">Login</button>
+          </form>
+        )}
+        <p className="signup-link">
+          <a href={`${API_BASE}/api/auth/oidc/login`}>Sign in with your company account</a>
+        </p>
+        <p className="signup-link">
+          <Link to="/forgot-password">Forgot your password?</Link>
+        </p>
         <p className="signup-link">
           Don’t have an account? <Link to="/signup">Sign up here</Link>
         </p>
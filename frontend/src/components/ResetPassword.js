@@ -0,0 +1,52 @@
+import { useState } from 'react';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+import './LoginForm.css';
+import { API_BASE, clearSession } from '../api';
+
+const ResetPassword = () => {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState('');
+  const navigate = useNavigate();
+  const token = searchParams.get('token') || '';
+
+  const handleSubmit = async e => {
+    e.preventDefault();
+    const res = await fetch(`${API_BASE}/api/auth/reset-password`, {
+      method: 'POST',
+      credentials: 'include', // so cookie session mode can clear its cookies
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token, password })
+    });
+
+    const data = await res.json();
+    if (res.ok) {
+      // Every session was revoked, including any in this browser
+      clearSession();
+      alert(data.message);
+      navigate('/login');
+    } else {
+      alert(data.error || 'Password reset failed');
+    }
+  };
+
+  return (
+    <div className="login-container">
+      <div className="login-box">
+        <h2 className="login-title">Choose a New Password</h2>
+        {token ? (
+          <form onSubmit={handleSubmit} className="login-form">
+            <input name="password" type="password" onChange={e => setPassword(e.target.value)} placeholder="New password" required className="login-input" />
+            <button type="submit" className="login-button">Reset password</button>
+          </form>
+        ) : (
+          <p>This reset link is incomplete. Please request a new one.</p>
+        )}
+        <p className="signup-link">
+          <Link to="/forgot-password">Request a new link</Link>
+        </p>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
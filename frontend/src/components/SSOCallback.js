@@ -0,0 +1,64 @@
+import { useEffect, useRef, useState } from 'react';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+import './LoginForm.css';
+import { API_BASE, saveSession } from '../api';
+
+// Messages for the "error" values the backend and identity provider redirect with
+const ERRORS = {
+  access_denied: 'Your account is not allowed to use GoTasks.',
+  invalid_state: 'The sign-in took too long or was started elsewhere. Please try again.',
+  invalid_username: 'Your identity provider did not send a usable username. Please ask an administrator for help.',
+  username_taken: 'No free username could be found for your account. Please ask an administrator for help.',
+};
+
+const SSOCallback = () => {
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState(null);
+  const navigate = useNavigate();
+  // The login code works once; guard against effects running twice in development
+  const redeemed = useRef(false);
+
+  useEffect(() => {
+    const code = searchParams.get('code');
+    const failure = searchParams.get('error');
+    if (failure || !code) {
+      setError(ERRORS[failure] || 'Single sign-on failed. Please try again.');
+      return;
+    }
+    if (redeemed.current) return;
+    redeemed.current = true;
+
+    const redeem = async () => {
+      const res = await fetch(`${API_BASE}/api/auth/oidc/token`, {
+        method: 'POST',
+        credentials: 'include',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ code })
+      });
+      const data = await res.json();
+      if (res.ok) {
+        saveSession(data);
+        navigate('/tasks');
+      } else {
+        setError(data.error || 'Single sign-on failed. Please try again.');
+      }
+    };
+    redeem();
+  }, [searchParams, navigate]);
+
+  return (
+    <div className="login-container">
+      <div className="login-box">
+        <h2 className="login-title">Single Sign-On</h2>
+        <p>{error || 'Signing you in…'}</p>
+        {error && (
+          <p className="signup-link">
+            <Link to="/login">Back to login</Link>
+          </p>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default SSOCallback;
@@ -1,23 +1,39 @@
 import { useState, useEffect } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
 import './SignupForm.css'; // Link to the CSS file
+import { API_BASE, hasSession } from '../api';
 
 const SignupForm = () => {
-    const [form, setForm] = useState({ username: '', password: '', role: 'user' });
+    const [form, setForm] = useState({ username: '', email: '', password: '' });
+    const [usernameTaken, setUsernameTaken] = useState(false);
+    // Password rules the server rejected, as [{ rule, message }]
+    const [passwordViolations, setPasswordViolations] = useState([]);
     const navigate = useNavigate();
 
     useEffect(() => {
-        const token = localStorage.getItem('token');
-        if (token) {
+        if (hasSession()) {
             navigate('/tasks');
         }
     }, [navigate]);
 
-    const handleChange = e => setForm({ ...form, [e.target.name]: e.target.value });
+    const handleChange = e => {
+        if (e.target.name === 'username') setUsernameTaken(false);
+        if (e.target.name === 'password') setPasswordViolations([]);
+        setForm({ ...form, [e.target.name]: e.target.value });
+    };
+
+    // Warn early if the username is already registered
+    const checkUsername = async () => {
+        if (!form.username.trim()) return;
+        const res = await fetch(`${API_BASE}/api/auth/username-available?username=${encodeURIComponent(form.username)}`);
+        if (res.ok) {
+            const data = await res.json();
+            setUsernameTaken(!data.available);
+        }
+    };
 
     const handleSubmit = async e => {
         e.preventDefault();
-        const API_BASE = 'http://localhost:8080';
         const res = await fetch(`${API_BASE}/api/auth/register`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
@@ -29,6 +45,11 @@ const SignupForm = () => {
             navigate('/login');
         } else {
             const data = await res.json();
+            if (data.code === 'username_taken') setUsernameTaken(true);
+            if (data.code === 'weak_password') {
+                setPasswordViolations(data.violations || []);
+                return;
+            }
             alert(data.error || 'Signup failed');
         }
     };
@@ -42,9 +63,18 @@ const SignupForm = () => {
                         name="username"
                         placeholder="Username"
                         onChange={handleChange}
+                        onBlur={checkUsername}
                         required
                         className="signup-input"
                     />
+                    {usernameTaken && <p className="signup-error">That username is already taken</p>}
+                    <input
+                        name="email"
+                        type="email"
+                        placeholder="Email (optional, for password resets)"
+                        onChange={handleChange}
+                        className="signup-input"
+                    />
                     <input
                         name="password"
                         type="password"
@@ -53,14 +83,9 @@ const SignupForm = () => {
                         required
                         className="signup-input"
                     />
-                    <select
-                        name="role"
-                        onChange={handleChange}
-                        className="signup-select"
-                    >
-                        <option value="user">User</option>
-                        <option value="admin">Admin</option>
-                    </select>
+                    {passwordViolations.map(v => (
+                        <p key={v.rule} className="signup-error">{v.message}</p>
+                    ))}
                     <button type="submit" className="signup-button">Register</button>
                 </form>
                 <p className="login-link">
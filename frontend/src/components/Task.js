@@ -1,6 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
 import './TaskDetails.css';
+import { apiFetch } from '../api';
 
 const TaskDetails = () => {
   const { id } = useParams();
@@ -9,7 +10,7 @@ const TaskDetails = () => {
   const [error, setError] = useState(null);
 
   useEffect(() => {
-    fetch(`http://localhost:8080/tasks/${id}`)
+    apiFetch(`http://localhost:8080/tasks/${id}`)
       .then((res) => res.json())
       .then((data) => setTask(data))
       .catch((err) => {
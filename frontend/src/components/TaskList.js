@@ -1,6 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import './TaskList.css'; // Add this to include custom styles
+import { apiFetch } from '../api';
 
 const TaskList = () => {
   const [showConfirm, setShowConfirm] = useState(false);
@@ -12,7 +13,7 @@ const TaskList = () => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    fetch('http://localhost:8080/tasks')
+    apiFetch('http://localhost:8080/tasks')
       .then((response) => response.json())
       .then((data) => {
         // Assuming data is an array
@@ -40,7 +41,7 @@ const TaskList = () => {
   };
 
   const confirmDelete = () => {
-    fetch(`http://localhost:8080/tasks/${taskToDelete}`, {
+    apiFetch(`http://localhost:8080/tasks/${taskToDelete}`, {
       method: 'DELETE',
     })
       .then((response) => {
@@ -73,12 +74,13 @@ const TaskList = () => {
     setTasks(updatedTasks);
 
     // Optionally, you can update the task completion status in the backend as well
-    fetch(`http://localhost:8080/tasks/${taskId}`, {
-      method: 'PUT',
+    // Only send the flag, so a concurrent edit of the title or description is not overwritten
+    apiFetch(`http://localhost:8080/tasks/${taskId}`, {
+      method: 'PATCH',
       headers: {
-      'Content-Type': 'application/json',
+      'Content-Type': 'application/merge-patch+json',
       },
-      body: JSON.stringify(updatedTasks.find((task) => task.id === taskId)),
+      body: JSON.stringify({ completed: updatedTasks.find((task) => task.id === taskId).completed }),
     })
       .then((response) => {
       if (!response.ok) {
@@ -91,7 +93,7 @@ const TaskList = () => {
       })
       .finally(() => {
       // call task list again to refresh the data
-      fetch('http://localhost:8080/tasks')
+      apiFetch('http://localhost:8080/tasks')
         .then((response) => response.json())
         .then((data) => {
           setTasks(data);